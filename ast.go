@@ -0,0 +1,345 @@
+package goplate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Node is an element in the syntax tree of a parsed template. The String
+// method returns the node in template syntax with the default delimiters.
+type Node interface {
+	Position() Pos
+	String() string
+}
+
+// Pos is the position of a node in the template string. Lines and columns
+// start at 1, the column is counted in bytes.
+type Pos struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Position returns the position. It is promoted to the nodes embedding Pos.
+func (p Pos) Position() Pos {
+	return p
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// ListNode is a sequence of nodes, ie the template itself or the contents of
+// a block.
+type ListNode struct {
+	Pos
+	Nodes []Node
+}
+
+// TextNode is static text. Escaped delimiters and the contents of raw blocks
+// are unescaped and trim markers have been applied.
+type TextNode struct {
+	Pos
+	Text string
+}
+
+// CommentNode is a comment. Comments don't render anything.
+type CommentNode struct {
+	Pos
+	Text string
+}
+
+// ActionNode is a tag writing the result of the pipeline.
+type ActionNode struct {
+	Pos
+	Pipe *PipeNode
+}
+
+// PipeNode is an expression followed by zero or more transforms.
+type PipeNode struct {
+	Pos
+	Expr       Node
+	Transforms []*TransformNode
+}
+
+// TransformNode is a transform in a pipeline. The arguments are literals.
+type TransformNode struct {
+	Pos
+	Name string
+	Args []*LiteralNode
+}
+
+// FieldNode is a reference to a field in the parameters, optionally with a
+// map key. The path is the lower case dot separated field names. Fields
+// starting with a variable are relative to the variable and the path is empty
+// when the variable itself is used.
+type FieldNode struct {
+	Pos
+	Variable string
+	Path     string
+	Key      string
+	HasKey   bool
+}
+
+// LiteralNode is a constant. The value is a bool, int64, float64 or string.
+type LiteralNode struct {
+	Pos
+	Value interface{}
+}
+
+// MessageNode is a message from the catalog, ie `t "device.offline" name`.
+// The arguments are the values used in the message, in order.
+type MessageNode struct {
+	Pos
+	Key  string
+	Args []Node
+}
+
+// UnaryNode is a unary operation, ie negation.
+type UnaryNode struct {
+	Pos
+	Op      string
+	Operand Node
+}
+
+// BinaryNode is a binary operation with a left and a right operand.
+type BinaryNode struct {
+	Pos
+	Op    string
+	Left  Node
+	Right Node
+}
+
+// AssignNode assigns the result of the pipeline to a variable.
+type AssignNode struct {
+	Pos
+	Variable string
+	Pipe     *PipeNode
+}
+
+// IfNode is a conditional section. ElseList is nil if there is no else
+// section.
+type IfNode struct {
+	Pos
+	Cond     *PipeNode
+	List     *ListNode
+	ElseList *ListNode
+}
+
+// IncludeNode includes a partial. Pipe is the field with the parameters for
+// the partial and nil if the partial uses the current parameters.
+type IncludeNode struct {
+	Pos
+	Name string
+	Pipe *PipeNode
+}
+
+// BlockNode is a section that can be overridden by templates extending this
+// one.
+type BlockNode struct {
+	Pos
+	Name string
+	List *ListNode
+}
+
+// DefineNode overrides a block in the template being extended.
+type DefineNode struct {
+	Pos
+	Name string
+	List *ListNode
+}
+
+// ExtendsNode makes the template extend another template.
+type ExtendsNode struct {
+	Pos
+	Name string
+}
+
+func (n *ListNode) String() string {
+	var sb strings.Builder
+	for _, node := range n.Nodes {
+		sb.WriteString(node.String())
+	}
+	return sb.String()
+}
+
+func (n *TextNode) String() string {
+	return strings.ReplaceAll(n.Text, defaultLeftDelimiter, string(escapeChar)+defaultLeftDelimiter)
+}
+
+func (n *CommentNode) String() string {
+	return defaultLeftDelimiter + commentStart + n.Text + commentEnd + defaultRightDelimiter
+}
+
+func (n *ActionNode) String() string {
+	return tag(n.Pipe.String())
+}
+
+func (n *PipeNode) String() string {
+	var sb strings.Builder
+	sb.WriteString(n.Expr.String())
+	for _, t := range n.Transforms {
+		sb.WriteString(" | ")
+		sb.WriteString(t.String())
+	}
+	return sb.String()
+}
+
+func (n *TransformNode) String() string {
+	s := n.Name
+	for _, arg := range n.Args {
+		s += " " + arg.String()
+	}
+	return s
+}
+
+func (n *FieldNode) String() string {
+	var name string
+	switch {
+	case n.Variable == "":
+		name = n.Path
+	case n.Path == "":
+		name = n.Variable
+	default:
+		name = n.Variable + "." + n.Path
+	}
+	if n.HasKey {
+		name += "[" + strconv.Quote(n.Key) + "]"
+	}
+	return name
+}
+
+func (n *LiteralNode) String() string {
+	switch v := n.Value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		// Keep the decimal point so the literal is still a float
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	}
+	return fmt.Sprint(n.Value)
+}
+
+func (n *MessageNode) String() string {
+	s := "t " + strconv.Quote(n.Key)
+	for _, arg := range n.Args {
+		s += " " + operand(arg)
+	}
+	return s
+}
+
+func (n *UnaryNode) String() string {
+	return n.Op + operand(n.Operand)
+}
+
+func (n *BinaryNode) String() string {
+	return operand(n.Left) + " " + n.Op + " " + operand(n.Right)
+}
+
+func (n *AssignNode) String() string {
+	return tag(n.Variable + " := " + n.Pipe.String())
+}
+
+// The condition is nil if the tag couldn't be parsed, the tag is written
+// without it
+func (n *IfNode) String() string {
+	cond := "if"
+	if n.Cond != nil {
+		cond += " " + n.Cond.String()
+	}
+	s := tag(cond) + n.List.String()
+	if n.ElseList != nil {
+		s += tag("else") + n.ElseList.String()
+	}
+	return s + tag("end")
+}
+
+func (n *IncludeNode) String() string {
+	if n.Pipe == nil {
+		return tag("include " + strconv.Quote(n.Name))
+	}
+	return tag("template " + strconv.Quote(n.Name) + " " + n.Pipe.String())
+}
+
+func (n *BlockNode) String() string {
+	return tag("block "+strconv.Quote(n.Name)) + n.List.String() + tag("end")
+}
+
+func (n *DefineNode) String() string {
+	return tag("define "+strconv.Quote(n.Name)) + n.List.String() + tag("end")
+}
+
+func (n *ExtendsNode) String() string {
+	return tag("extends " + strconv.Quote(n.Name))
+}
+
+// tag returns the contents wrapped in the default delimiters
+func tag(contents string) string {
+	return defaultLeftDelimiter + " " + contents + " " + defaultRightDelimiter
+}
+
+// operand returns an operand in an operation. Nested operations are wrapped
+// in parentheses so the precedence is kept.
+func operand(n Node) string {
+	if _, ok := n.(*BinaryNode); ok {
+		return "(" + n.String() + ")"
+	}
+	return n.String()
+}
+
+// Walk traverses the tree depth first and calls fn for each node. The
+// children of a node are skipped if fn returns false.
+func Walk(node Node, fn func(Node) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+	switch n := node.(type) {
+	case *ListNode:
+		for _, child := range n.Nodes {
+			Walk(child, fn)
+		}
+	case *ActionNode:
+		Walk(n.Pipe, fn)
+	case *PipeNode:
+		Walk(n.Expr, fn)
+		for _, t := range n.Transforms {
+			Walk(t, fn)
+		}
+	case *TransformNode:
+		for _, arg := range n.Args {
+			Walk(arg, fn)
+		}
+	case *MessageNode:
+		for _, arg := range n.Args {
+			Walk(arg, fn)
+		}
+	case *UnaryNode:
+		Walk(n.Operand, fn)
+	case *BinaryNode:
+		Walk(n.Left, fn)
+		Walk(n.Right, fn)
+	case *AssignNode:
+		Walk(n.Pipe, fn)
+	case *IfNode:
+		if n.Cond != nil {
+			Walk(n.Cond, fn)
+		}
+		Walk(n.List, fn)
+		if n.ElseList != nil {
+			Walk(n.ElseList, fn)
+		}
+	case *IncludeNode:
+		if n.Pipe != nil {
+			Walk(n.Pipe, fn)
+		}
+	case *BlockNode:
+		Walk(n.List, fn)
+	case *DefineNode:
+		Walk(n.List, fn)
+	}
+}
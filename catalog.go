@@ -0,0 +1,436 @@
+package goplate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Catalog holds the translated messages used with `{{ t "key" args }}`.
+// Messages are looked up in the locale of the execution, the language of the
+// locale, the fallbacks for the locale and finally the default locales. A
+// catalog can be updated while templates using it are executed.
+//
+// Messages added with Add and loaded from JSON and YAML files use a subset
+// of the ICU MessageFormat syntax where arguments are numbered from 0:
+//
+//	{0} is offline
+//	{0, plural, =0 {No devices} one {# device} other {# devices}} in {1}
+//	{0, select, sensor {The sensor} other {The device}} is offline
+//
+// Messages in gettext files use printf verbs for the arguments and the
+// Plural-Forms header for the plural forms.
+type Catalog struct {
+	lock      sync.RWMutex
+	messages  map[string]map[string]*message
+	fallbacks map[string][]string
+	defaults  []string
+	// chains caches the locales to look up for each locale
+	chains map[string][]string
+}
+
+// NewCatalog creates an empty message catalog
+func NewCatalog() *Catalog {
+	return &Catalog{
+		messages:  make(map[string]map[string]*message),
+		fallbacks: make(map[string][]string),
+		chains:    make(map[string][]string),
+	}
+}
+
+// normalizeTag returns the tag in lower case with dashes, ie "en-us"
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+}
+
+// WithFallback sets the locales used for messages missing in the locale,
+// ie WithFallback("nn", "nb") to use Bokmål for missing Nynorsk messages.
+// The fallbacks are tried before the language of the locale.
+func (c *Catalog) WithFallback(locale string, fallbacks ...string) *Catalog {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.fallbacks[normalizeTag(locale)] = fallbacks
+	c.chains = make(map[string][]string)
+	return c
+}
+
+// WithDefault sets the locales used for messages missing in all the other
+// locales, ie WithDefault("en")
+func (c *Catalog) WithDefault(locales ...string) *Catalog {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.defaults = locales
+	c.chains = make(map[string][]string)
+	return c
+}
+
+// Add adds a message in the ICU syntax
+func (c *Catalog) Add(locale string, key string, text string) error {
+	m, err := parseMessage(text)
+	if err != nil {
+		return fmt.Errorf("message %s: %v", key, err)
+	}
+	c.add(locale, map[string]*message{key: m})
+	return nil
+}
+
+// add adds parsed messages to the locale
+func (c *Catalog) add(locale string, messages map[string]*message) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	tag := normalizeTag(locale)
+	if c.messages[tag] == nil {
+		c.messages[tag] = make(map[string]*message)
+	}
+	for key, m := range messages {
+		c.messages[tag][key] = m
+	}
+}
+
+// LoadJSON loads messages from a JSON object. Nested objects are flattened
+// with dots, ie {"device": {"offline": "..."}} is the message
+// "device.offline".
+func (c *Catalog) LoadJSON(locale string, r io.Reader) error {
+	var obj map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&obj); err != nil {
+		return err
+	}
+	return c.loadMap(locale, obj)
+}
+
+// LoadYAML loads messages from a YAML mapping. Nested mappings are
+// flattened like in LoadJSON.
+func (c *Catalog) LoadYAML(locale string, r io.Reader) error {
+	var obj map[string]interface{}
+	if err := yaml.NewDecoder(r).Decode(&obj); err != nil && err != io.EOF {
+		return err
+	}
+	return c.loadMap(locale, obj)
+}
+
+// loadMap parses the messages in a decoded JSON or YAML file. Nothing is
+// added if one of the messages is invalid.
+func (c *Catalog) loadMap(locale string, obj map[string]interface{}) error {
+	messages := make(map[string]*message)
+	var flatten func(prefix string, obj map[string]interface{}) error
+	flatten = func(prefix string, obj map[string]interface{}) error {
+		for key, v := range obj {
+			switch val := v.(type) {
+			case string:
+				m, err := parseMessage(val)
+				if err != nil {
+					return fmt.Errorf("message %s%s: %v", prefix, key, err)
+				}
+				messages[prefix+key] = m
+			case map[string]interface{}:
+				if err := flatten(prefix+key+".", val); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("message %s%s must be a string", prefix, key)
+			}
+		}
+		return nil
+	}
+	if err := flatten("", obj); err != nil {
+		return err
+	}
+	c.add(locale, messages)
+	return nil
+}
+
+// LoadPO loads messages from a gettext .po file. The msgid is the key and
+// the msgctxt, if set, is added in front of it with a dot. The locale is
+// read from the Language header if it is empty. Untranslated and fuzzy
+// messages are skipped.
+func (c *Catalog) LoadPO(locale string, r io.Reader) error {
+	entries, err := readPO(r)
+	if err != nil {
+		return err
+	}
+	plural := defaultPluralForms
+	messages := make(map[string]*message)
+	for _, e := range entries {
+		if e.id == "" && e.context == "" {
+			for _, line := range strings.Split(e.str[0], "\n") {
+				kv := strings.SplitN(line, ":", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				switch strings.TrimSpace(kv[0]) {
+				case "Language":
+					if locale == "" {
+						locale = strings.TrimSpace(kv[1])
+					}
+				case "Plural-Forms":
+					if plural, err = parsePluralForms(kv[1]); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+		if e.fuzzy {
+			continue
+		}
+		key := e.id
+		if e.context != "" {
+			key = e.context + "." + e.id
+		}
+		if !e.plural {
+			if e.str[0] != "" {
+				messages[key] = parsePrintf(e.str[0])
+			}
+			continue
+		}
+		m := &message{}
+		for i := 0; i < len(e.str); i++ {
+			if e.str[i] == "" {
+				m = nil
+				break
+			}
+			m.forms = append(m.forms, parsePrintf(e.str[i]))
+		}
+		if m != nil && len(m.forms) > 0 {
+			messages[key] = m
+		}
+	}
+	if locale == "" {
+		return fmt.Errorf("the locale isn't set and the file has no Language header")
+	}
+	for _, m := range messages {
+		if len(m.forms) > 0 {
+			m.plural = plural
+		}
+	}
+	c.add(locale, messages)
+	return nil
+}
+
+// poEntry is an entry in a .po file. The msgstr with index n is str[n].
+type poEntry struct {
+	context string
+	id      string
+	plural  bool
+	str     []string
+	fuzzy   bool
+}
+
+// readPO reads the entries in a .po file
+func readPO(r io.Reader) ([]*poEntry, error) {
+	var entries []*poEntry
+	var entry *poEntry
+	// field points to the string continued by lines with only a string
+	var field *string
+	fuzzy := false
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			if strings.HasPrefix(text, "#,") && strings.Contains(text, "fuzzy") {
+				fuzzy = true
+			}
+			continue
+		}
+		if strings.HasPrefix(text, `"`) {
+			s, err := strconv.Unquote(text)
+			if err != nil || field == nil {
+				return nil, fmt.Errorf("line %d: invalid string %s", line, text)
+			}
+			*field += s
+			continue
+		}
+		fields := strings.SplitN(text, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected keyword and string", line)
+		}
+		s, err := strconv.Unquote(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid string %s", line, fields[1])
+		}
+		keyword := fields[0]
+		// msgctxt and msgid start a new entry unless the entry only has a
+		// context so far
+		if keyword == "msgctxt" || keyword == "msgid" && (entry == nil || entry.str != nil) {
+			entry = &poEntry{fuzzy: fuzzy}
+			entries = append(entries, entry)
+			fuzzy = false
+		}
+		switch {
+		case keyword == "msgctxt":
+			entry.context = s
+			field = &entry.context
+		case keyword == "msgid":
+			entry.id = s
+			field = &entry.id
+		case keyword == "msgid_plural" && entry != nil:
+			entry.plural = true
+			field = nil
+		case keyword == "msgstr" && entry != nil:
+			entry.str = []string{s}
+			field = &entry.str[0]
+		case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]") && entry != nil:
+			n, err := strconv.Atoi(keyword[len("msgstr[") : len(keyword)-1])
+			if err != nil || n != len(entry.str) {
+				return nil, fmt.Errorf("line %d: unexpected %s", line, keyword)
+			}
+			entry.str = append(entry.str, s)
+			field = &entry.str[n]
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %s", line, keyword)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.str == nil {
+			return nil, fmt.Errorf("msgid %q has no msgstr", e.id)
+		}
+	}
+	return entries, nil
+}
+
+// LoadFile loads a JSON, YAML or gettext file by the extension of the file
+// name. The locale is the file name without the extension if it is empty,
+// ie "de-DE.json".
+func (c *Catalog) LoadFile(locale string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ext := strings.ToLower(filepath.Ext(path))
+	if locale == "" && ext != ".po" {
+		locale = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	switch ext {
+	case ".json":
+		err = c.LoadJSON(locale, f)
+	case ".yaml", ".yml":
+		err = c.LoadYAML(locale, f)
+	case ".po":
+		err = c.LoadPO(locale, f)
+	default:
+		return fmt.Errorf("%s: unknown catalog format", path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// chain returns the locales to look up for a locale. The lock must be held.
+func (c *Catalog) chain(locale string) []string {
+	tag := normalizeTag(locale)
+	if chain, ok := c.chains[tag]; ok {
+		return chain
+	}
+	var chain []string
+	seen := make(map[string]bool)
+	var visit func(tag string)
+	visit = func(tag string) {
+		if seen[tag] {
+			return
+		}
+		seen[tag] = true
+		chain = append(chain, tag)
+		for _, fallback := range c.fallbacks[tag] {
+			visit(normalizeTag(fallback))
+		}
+		if i := strings.LastIndexByte(tag, '-'); i > 0 {
+			visit(tag[:i])
+		}
+	}
+	visit(tag)
+	for _, def := range c.defaults {
+		visit(normalizeTag(def))
+	}
+	c.chains[tag] = chain
+	return chain
+}
+
+// lookup returns the message for the key and the locale of the message
+func (c *Catalog) lookup(locale string, key string) (*message, string) {
+	c.lock.RLock()
+	chain, ok := c.chains[normalizeTag(locale)]
+	c.lock.RUnlock()
+	if !ok {
+		c.lock.Lock()
+		chain = c.chain(locale)
+		c.lock.Unlock()
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, tag := range chain {
+		if m, ok := c.messages[tag][key]; ok {
+			return m, tag
+		}
+	}
+	return nil, ""
+}
+
+// argCount returns the largest number of arguments used by the message in
+// any locale. The boolean is false if the message isn't in the catalog.
+func (c *Catalog) argCount(key string) (int, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	count, found := 0, false
+	for _, messages := range c.messages {
+		if m, ok := messages[key]; ok {
+			found = true
+			if n := m.argCount(); n > count {
+				count = n
+			}
+		}
+	}
+	return count, found
+}
+
+// format formats the message for the locale. The key is returned if the
+// message isn't found in any of the locales.
+func (c *Catalog) format(locale string, l *Locale, key string, args []interface{}) string {
+	m, tag := c.lookup(locale, key)
+	if m == nil {
+		return key
+	}
+	var b strings.Builder
+	m.format(&b, &messageContext{locale: l, tag: pluralTag(locale, tag), args: args}, nil)
+	return b.String()
+}
+
+// pluralTag returns the tag selecting the plural rules for a message found in
+// the locale. The requested locale is used, or its base language, so a
+// message from a fallback locale is pluralized for the reader. The locale of
+// the message is used when there are no rules for the requested language.
+func pluralTag(requested string, found string) string {
+	if hasPluralRules(requested) {
+		return requested
+	}
+	return found
+}
+
+// Format returns the message for the key in the locale with the arguments.
+// Numbers and dates are formatted with the bundled or registered locale
+// data for the locale, using DefaultLocale if there is none. The key is
+// returned if the message isn't in the catalog.
+func (c *Catalog) Format(locale string, key string, args ...interface{}) string {
+	l, err := LookupLocale(locale)
+	if err != nil {
+		l, _ = LookupLocale(DefaultLocale)
+	}
+	return c.format(locale, l, key, args)
+}
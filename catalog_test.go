@@ -0,0 +1,241 @@
+package goplate
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testPO = `# Norwegian messages
+msgid ""
+msgstr ""
+"Language: nb\n"
+"Plural-Forms: nplurals=2; plural=(n != 1);\n"
+
+msgid "device.offline"
+msgstr "%s er frakoblet"
+
+msgid "device.count"
+msgid_plural "devices"
+msgstr[0] "%d enhet"
+msgstr[1] "%d enheter"
+
+msgctxt "alert"
+msgid "title"
+msgstr "Varsel: "
+"%[2]s fra %[1]s"
+
+#, fuzzy
+msgid "device.online"
+msgstr "%s er tilkoblet"
+
+msgid "untranslated"
+msgstr ""
+`
+
+func testCatalog(t *testing.T) *Catalog {
+	assert := require.New(t)
+	catalog := NewCatalog().WithDefault("en").WithFallback("nn", "nb")
+	assert.NoError(catalog.LoadJSON("en", strings.NewReader(`{
+		"device": {
+			"offline": "{0} is offline",
+			"online": "{0} is online",
+			"count": "{0, plural, =0 {No devices} one {# device} other {# devices}}"
+		},
+		"greeting": "{0, select, morning {Good morning} other {Hello}}, {1}!",
+		"total": "Total: {0, number}",
+		"quote": "It''s '{0}' {0}"
+	}`)))
+	assert.NoError(catalog.LoadYAML("de", strings.NewReader(`
+device:
+  offline: "{0} ist offline"
+  count: "{0, plural, one {# Gerät} other {# Geräte}}"
+`)))
+	assert.NoError(catalog.LoadPO("", strings.NewReader(testPO)))
+	assert.NoError(catalog.Add("ru", "device.count", "{0, plural, one {# устройство} few {# устройства} many {# устройств} other {# устройства}}"))
+	return catalog
+}
+
+func TestCatalog(t *testing.T) {
+	assert := require.New(t)
+	catalog := testCatalog(t)
+
+	tests := []struct {
+		locale   string
+		key      string
+		args     []interface{}
+		expected string
+	}{
+		{"en-US", "device.offline", []interface{}{"gw-1"}, "gw-1 is offline"},
+		{"en", "device.count", []interface{}{0}, "No devices"},
+		{"en", "device.count", []interface{}{1}, "1 device"},
+		{"en", "device.count", []interface{}{1234}, "1,234 devices"},
+		{"en", "greeting", []interface{}{"morning", "Ada"}, "Good morning, Ada!"},
+		{"en", "greeting", []interface{}{"evening", "Ada"}, "Hello, Ada!"},
+		{"en", "total", []interface{}{1234.5}, "Total: 1,234.5"},
+		{"en", "quote", []interface{}{"x"}, "It's {0} x"},
+		{"de-AT", "device.offline", []interface{}{"gw-1"}, "gw-1 ist offline"},
+		{"de-DE", "device.count", []interface{}{2000}, "2.000 Geräte"},
+		{"de", "device.online", []interface{}{"gw-1"}, "gw-1 is online"},
+		{"nb-NO", "device.offline", []interface{}{"gw-1"}, "gw-1 er frakoblet"},
+		{"nb", "device.count", []interface{}{1}, "1 enhet"},
+		{"nb", "device.count", []interface{}{int64(3)}, "3 enheter"},
+		{"nb", "alert.title", []interface{}{"gw-1", "temp"}, "Varsel: temp fra gw-1"},
+		{"nn", "device.offline", []interface{}{"gw-1"}, "gw-1 er frakoblet"},
+		{"nb", "device.online", []interface{}{"gw-1"}, "gw-1 is online"},
+		{"ru", "device.count", []interface{}{1}, "1 устройство"},
+		{"ru", "device.count", []interface{}{3}, "3 устройства"},
+		{"ru", "device.count", []interface{}{11}, "11 устройств"},
+		{"ru", "device.count", []interface{}{22}, "22 устройства"},
+		{"ru", "device.count", []interface{}{1.5}, "1.5 устройства"},
+		{"fr", "missing.key", nil, "missing.key"},
+		{"en", "untranslated", nil, "untranslated"},
+	}
+	for _, test := range tests {
+		assert.Equal(test.expected, catalog.Format(test.locale, test.key, test.args...), test.locale+" "+test.key)
+	}
+
+	for _, invalid := range []string{
+		"{name} is offline",
+		"{0 is offline",
+		"{0, plural, one {# device}}",
+		"{0, plural, some {x} other {y}}",
+		"{0, currency}",
+		"{0, date, weekly}",
+		"a } b",
+	} {
+		assert.Error(catalog.Add("en", "invalid", invalid), invalid)
+	}
+	assert.Error(catalog.LoadJSON("en", strings.NewReader(`{"a": 1}`)))
+	assert.Error(catalog.LoadPO("", strings.NewReader(`msgid "a"`+"\n"+`msgstr "b"`)))
+	assert.Error(catalog.LoadPO("en", strings.NewReader(`msgid "a"`+"\n"+`msgstr[1] "b"`)))
+	assert.Error(catalog.LoadPO("en", strings.NewReader(`msgid ""`+"\n"+`msgstr "Plural-Forms: nplurals=2; plural=(n !=;\n"`)))
+
+	// Files are loaded by their extension and named after the locale
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "sv.yaml"), []byte(`device: {offline: "{0} är offline"}`), 0o600))
+	assert.NoError(catalog.LoadFile("", filepath.Join(dir, "sv.yaml")))
+	assert.Equal("gw-1 är offline", catalog.Format("sv-SE", "device.offline", "gw-1"))
+	assert.Error(catalog.LoadFile("", filepath.Join(dir, "sv.txt")))
+}
+
+func TestPluralForms(t *testing.T) {
+	assert := require.New(t)
+
+	// Polish
+	forms, err := parsePluralForms("nplurals=3; plural=(n==1 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);")
+	assert.NoError(err)
+	for n, expected := range map[int64]int{1: 0, 2: 1, 5: 2, 12: 2, 22: 1, 25: 2, 0: 2} {
+		assert.Equal(expected, forms.index(n), n)
+	}
+	forms, err = parsePluralForms("nplurals=1; plural=0;")
+	assert.NoError(err)
+	assert.Equal(0, forms.index(7))
+
+	for _, invalid := range []string{"plural=n;", "nplurals=2;", "nplurals=2; plural=(n;", "nplurals=2; plural=n x;"} {
+		_, err := parsePluralForms(invalid)
+		assert.Error(err, invalid)
+	}
+
+	for tag, tests := range map[string]map[interface{}]string{
+		"en": {int64(1): "one", int64(0): "other", 1.0: "one", 1.5: "other"},
+		"fr": {int64(0): "one", 1.5: "one", int64(2): "other"},
+		"da": {int64(1): "one", 0.5: "one", int64(2): "other"},
+		"ja": {int64(1): "other"},
+		"pl": {int64(1): "one", int64(3): "few", int64(5): "many", int64(13): "many", 1.5: "other"},
+		"cs": {int64(1): "one", int64(3): "few", int64(5): "other", 1.5: "many"},
+	} {
+		for n, expected := range tests {
+			assert.Equal(expected, pluralCategory(tag, n), tag)
+		}
+	}
+}
+
+func TestPluralFallbackLocale(t *testing.T) {
+	assert := require.New(t)
+
+	catalog := NewCatalog().WithDefault("en").WithFallback("cs", "pl").WithFallback("xx", "pl")
+	assert.NoError(catalog.Add("en", "items", "{0, plural, one {# item} other {# items}}"))
+	assert.NoError(catalog.Add("pl", "items", "{0, plural, one {# one} few {# few} many {# many} other {# other}}"))
+
+	// The rules of the requested language are used for messages from
+	// fallback locales, the rules of the message's locale if there are none
+	assert.Equal("0 items", catalog.Format("en-US", "items", 0))
+	assert.Equal("0 item", catalog.Format("fr-FR", "items", 0))
+	assert.Equal("5 many", catalog.Format("pl", "items", 5))
+	assert.Equal("5 other", catalog.Format("cs-CZ", "items", 5))
+	assert.Equal("5 many", catalog.Format("xx", "items", 5))
+}
+
+func TestMessageTemplates(t *testing.T) {
+	assert := require.New(t)
+	catalog := testCatalog(t)
+
+	params := &testStructure{
+		String:       "gw-1",
+		Int32:        2,
+		Int32Wrapper: wrapperspb.Int32(1),
+	}
+	tmpl, err := New(`{{ t "device.offline" string | upper }}; {{ t "device.count" (int32 + 1) }}; {{ include "count" }}`).
+		WithParameters(&testStructure{}).
+		WithCatalog(catalog).
+		WithLocale("de-DE").
+		WithPartial("count", `{{ t "device.count" int32wrapper }}`).
+		Build()
+	assert.NoError(err)
+	s, err := tmpl.ExecuteString(params)
+	assert.NoError(err)
+	assert.Equal("GW-1 IST OFFLINE; 3 Geräte; 1 Gerät", s)
+
+	// The locale for the execution selects the messages
+	for locale, expected := range map[string]string{
+		"en-GB": "GW-1 IS OFFLINE; 3 devices; 1 device",
+		"nb-NO": "GW-1 ER FRAKOBLET; 3 enheter; 1 enhet",
+		"fr-FR": "GW-1 IS OFFLINE; 3 devices; 1 device",
+	} {
+		buf := &bytes.Buffer{}
+		assert.NoError(tmpl.ExecuteContext(context.Background(), buf, params, ExecuteOptions{Locale: locale}))
+		assert.Equal(expected, buf.String(), locale)
+	}
+
+	tests := map[string]string{
+		`{{ int32 | plural "# device" "# devices" }}`:                      "2 devices",
+		`{{ int32wrapper | plural "# device" "# devices" }}`:               "1 device",
+		`{{ int32 | plural "=2 {a pair} one {one} other {#}" }}`:           "a pair",
+		`{{ int64 | plural "one {# item} other {# items}" }}`:              "0 items",
+		`{{ string | plural "# device" "# devices" }}`:                     "gw-1",
+		`{{ string | select "gw-1 {Gateway} other {Device}" }}`:            "Gateway",
+		`{{ int32 | select "1 {one} other {not one}" }}`:                   "not one",
+		`{{ $n := int32 * 1000 }}{{ $n | plural "# device" "# devices" }}`: "2,000 devices",
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(params)
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+
+	for _, invalid := range []string{
+		`{{ t "device.offline" }}`,
+		`{{ t "no.such.message" string }}`,
+		`{{ t "device.offline" nofield }}`,
+		`{{ int32 | plural }}`,
+		`{{ int32 | plural "one {x}" }}`,
+		`{{ int32 | plural "a" "b" "c" }}`,
+		`{{ int32 | select "a {x} other {y" }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).WithCatalog(catalog).Build()
+		assert.Error(err, invalid)
+	}
+
+	// Messages need a catalog
+	_, err = New(`{{ t "device.offline" string }}`).WithParameters(&testStructure{}).Build()
+	assert.Error(err)
+}
@@ -0,0 +1,209 @@
+package goplate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxDecodeDepth is the maximum nesting of arrays and maps in decoded
+// payloads
+const maxDecodeDepth = 100
+
+var errCBORBreak = errors.New("unexpected break")
+
+// cborDecoder decodes CBOR (RFC 8949) into plain Go values. Unsigned integers
+// are uint64, negative integers int64, byte strings []byte, text strings
+// string, arrays []interface{} and maps map[string]interface{} with the keys
+// converted to text. Tags are skipped and the tagged value is returned.
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// decodeCBOR decodes a single CBOR value
+func decodeCBOR(data []byte) (interface{}, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, fmt.Errorf("cbor: %v", err)
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("cbor: %d bytes of trailing data", len(data)-d.pos)
+	}
+	return v, nil
+}
+
+func (d *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errors.New("unexpected end of data")
+	}
+	ret := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return ret, nil
+}
+
+// head reads the initial byte and the argument. The argument is the length
+// for strings, arrays and maps. indefinite is set for indefinite lengths.
+func (d *cborDecoder) head() (major byte, info byte, arg uint64, indefinite bool, err error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), false, nil
+	case info == 31:
+		return major, info, 0, true, nil
+	case info > 27:
+		return 0, 0, 0, false, fmt.Errorf("invalid additional information %d", info)
+	}
+	n := uint64(1) << (info - 24)
+	buf, err := d.read(n)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	switch n {
+	case 1:
+		arg = uint64(buf[0])
+	case 2:
+		arg = uint64(binary.BigEndian.Uint16(buf))
+	case 4:
+		arg = uint64(binary.BigEndian.Uint32(buf))
+	default:
+		arg = binary.BigEndian.Uint64(buf)
+	}
+	return major, info, arg, false, nil
+}
+
+// isBreak checks if the next byte ends an indefinite length item
+func (d *cborDecoder) isBreak() bool {
+	if d.pos < len(d.data) && d.data[d.pos] == 0xff {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, errors.New("nested too deep")
+	}
+	major, info, arg, indefinite, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if indefinite && (major < 2 || major == 6) {
+		return nil, fmt.Errorf("invalid indefinite length for major type %d", major)
+	}
+	switch major {
+	case 0:
+		return arg, nil
+
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("negative integer overflows")
+		}
+		return -1 - int64(arg), nil
+
+	case 2, 3:
+		var buf []byte
+		if indefinite {
+			for !d.isBreak() {
+				chunk, err := d.value(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				switch c := chunk.(type) {
+				case []byte:
+					buf = append(buf, c...)
+				case string:
+					buf = append(buf, c...)
+				}
+			}
+		} else if buf, err = d.read(arg); err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			return string(buf), nil
+		}
+		return append([]byte(nil), buf...), nil
+
+	case 4:
+		var ret []interface{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if indefinite && d.isBreak() {
+				break
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+		}
+		if ret == nil {
+			ret = []interface{}{}
+		}
+		return ret, nil
+
+	case 5:
+		ret := make(map[string]interface{})
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if indefinite && d.isBreak() {
+				break
+			}
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			ret[formatValue(key)] = v
+		}
+		return ret, nil
+
+	case 6:
+		return d.value(depth + 1)
+	}
+
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return float64(halfToFloat(uint16(arg))), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	case 31:
+		return nil, errCBORBreak
+	}
+	return nil, fmt.Errorf("unsupported simple value %d", arg)
+}
+
+// halfToFloat converts an IEEE 754 half precision float
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h) & 0x3ff
+	switch exp {
+	case 0:
+		// Zero or subnormal
+		f := float32(frac) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	case 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | frac<<13)
+}
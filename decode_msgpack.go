@@ -0,0 +1,189 @@
+package goplate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// msgpackDecoder decodes MessagePack into plain Go values like the CBOR
+// decoder. Extension types are returned as the raw data.
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+// decodeMsgpack decodes a single MessagePack value
+func decodeMsgpack(data []byte) (interface{}, error) {
+	d := &msgpackDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, fmt.Errorf("msgpack: %v", err)
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("msgpack: %d bytes of trailing data", len(data)-d.pos)
+	}
+	return v, nil
+}
+
+func (d *msgpackDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errors.New("unexpected end of data")
+	}
+	ret := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return ret, nil
+}
+
+// uint reads a big endian unsigned integer of n bytes
+func (d *msgpackDecoder) uint(n uint64) (uint64, error) {
+	buf, err := d.read(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(buf[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(buf)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(buf)), nil
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+func (d *msgpackDecoder) value(depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, errors.New("nested too deep")
+	}
+	b, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return uint64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return d.mapValue(uint64(c&0x0f), depth)
+	case c >= 0x90 && c <= 0x9f:
+		return d.array(uint64(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		return d.str(uint64(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		buf, err := d.read(n)
+		return append([]byte(nil), buf...), err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	case 0xca:
+		v, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.uint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (c - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := uint64(1) << (c - 0xd0)
+		v, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign extend
+		shift := 64 - 8*size
+		return int64(v<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapValue(n, depth)
+	}
+	return nil, fmt.Errorf("invalid type 0x%02x", c)
+}
+
+func (d *msgpackDecoder) str(n uint64) (interface{}, error) {
+	buf, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(buf), nil
+}
+
+// ext reads an extension with n bytes of data after the type
+func (d *msgpackDecoder) ext(n uint64) (interface{}, error) {
+	if _, err := d.read(1); err != nil {
+		return nil, err
+	}
+	buf, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buf...), nil
+}
+
+func (d *msgpackDecoder) array(n uint64, depth int) (interface{}, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		// Each element is at least one byte
+		return nil, errors.New("unexpected end of data")
+	}
+	ret := make([]interface{}, n)
+	for i := range ret {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = v
+	}
+	return ret, nil
+}
+
+func (d *msgpackDecoder) mapValue(n uint64, depth int) (interface{}, error) {
+	ret := make(map[string]interface{})
+	for i := uint64(0); i < n; i++ {
+		key, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		ret[formatValue(key)] = v
+	}
+	return ret, nil
+}
@@ -0,0 +1,386 @@
+package goplate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// valueEncoder writes the values found by encodeValue in a binary format
+type valueEncoder interface {
+	null()
+	boolean(b bool)
+	int(n int64)
+	uint(n uint64)
+	float(f float64)
+	str(s string)
+	bytes(b []byte)
+	array(n int)
+	mapping(n int)
+}
+
+// plainValue returns the value of wrapper types
+func plainValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case *wrapperspb.StringValue:
+		return val.GetValue()
+	case *wrapperspb.Int32Value:
+		return val.GetValue()
+	case *wrapperspb.Int64Value:
+		return val.GetValue()
+	case *wrapperspb.UInt32Value:
+		return val.GetValue()
+	case *wrapperspb.UInt64Value:
+		return val.GetValue()
+	case *wrapperspb.FloatValue:
+		return val.GetValue()
+	case *wrapperspb.DoubleValue:
+		return val.GetValue()
+	case *wrapperspb.BoolValue:
+		return val.GetValue()
+	case *wrapperspb.BytesValue:
+		return val.GetValue()
+	}
+	return v
+}
+
+// structField is an exported field of a structure
+type structField struct {
+	name  string
+	value reflect.Value
+}
+
+// structFields returns the exported fields of a structure. Fields are named
+// like encoding/json does and fields tagged with `json:"-"` are skipped.
+func structFields(rv reflect.Value) []structField {
+	var ret []structField
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tagName := strings.Split(tag, ",")[0]
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		ret = append(ret, structField{name: name, value: rv.Field(i)})
+	}
+	return ret
+}
+
+// sortedKeys returns the keys of a map sorted by their text
+func sortedKeys(rv reflect.Value) []reflect.Value {
+	keys := rv.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	return keys
+}
+
+// encodeValue walks the value and writes it with the encoder. Structures are
+// encoded as maps and map keys are sorted so the output is stable.
+func encodeValue(e valueEncoder, rv reflect.Value, depth int) error {
+	if depth > maxDecodeDepth {
+		return errors.New("nested too deep")
+	}
+	if rv.Kind() == reflect.Ptr && rv.CanInterface() {
+		if v := plainValue(rv.Interface()); v != rv.Interface() {
+			rv = reflect.ValueOf(v)
+		}
+	}
+	switch rv.Kind() {
+	case reflect.Invalid:
+		e.null()
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			e.null()
+			return nil
+		}
+		return encodeValue(e, rv.Elem(), depth+1)
+	case reflect.Bool:
+		e.boolean(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uint(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.float(rv.Float())
+	case reflect.String:
+		e.str(rv.String())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			e.null()
+			return nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			e.bytes(b)
+			return nil
+		}
+		e.array(rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			if err := encodeValue(e, rv.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if rv.IsNil() {
+			e.null()
+			return nil
+		}
+		e.mapping(rv.Len())
+		for _, key := range sortedKeys(rv) {
+			if err := encodeValue(e, key, depth+1); err != nil {
+				return err
+			}
+			if err := encodeValue(e, rv.MapIndex(key), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := structFields(rv)
+		e.mapping(len(fields))
+		for _, f := range fields {
+			e.str(f.name)
+			if err := encodeValue(e, f.value, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", rv.Type())
+	}
+	return nil
+}
+
+// isFloat32 checks if the float can be encoded with 32 bits without losing
+// precision
+func isFloat32(f float64) bool {
+	return float64(float32(f)) == f
+}
+
+// cborEncoder encodes values as CBOR. Floats are encoded with 32 bits when
+// it doesn't lose precision.
+type cborEncoder struct {
+	buf []byte
+}
+
+// marshalCBOR encodes the value as CBOR
+func marshalCBOR(v interface{}) ([]byte, error) {
+	e := &cborEncoder{}
+	if err := encodeValue(e, reflect.ValueOf(v), 0); err != nil {
+		return nil, fmt.Errorf("cbor: %v", err)
+	}
+	return e.buf, nil
+}
+
+func (e *cborEncoder) head(major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, major|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, major|25)
+		e.buf = appendUint16(e.buf, uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, major|26)
+		e.buf = appendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, major|27)
+		e.buf = appendUint64(e.buf, n)
+	}
+}
+
+func (e *cborEncoder) null() { e.buf = append(e.buf, 0xf6) }
+
+func (e *cborEncoder) boolean(b bool) {
+	if b {
+		e.buf = append(e.buf, 0xf5)
+		return
+	}
+	e.buf = append(e.buf, 0xf4)
+}
+
+func (e *cborEncoder) int(n int64) {
+	if n < 0 {
+		e.head(1, uint64(-1-n))
+		return
+	}
+	e.head(0, uint64(n))
+}
+
+func (e *cborEncoder) uint(n uint64) { e.head(0, n) }
+
+func (e *cborEncoder) float(f float64) {
+	if isFloat32(f) {
+		e.buf = append(e.buf, 0xfa)
+		e.buf = appendUint32(e.buf, math.Float32bits(float32(f)))
+		return
+	}
+	e.buf = append(e.buf, 0xfb)
+	e.buf = appendUint64(e.buf, math.Float64bits(f))
+}
+
+func (e *cborEncoder) str(s string) {
+	e.head(3, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *cborEncoder) bytes(b []byte) {
+	e.head(2, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *cborEncoder) array(n int) { e.head(4, uint64(n)) }
+
+func (e *cborEncoder) mapping(n int) { e.head(5, uint64(n)) }
+
+// msgpackEncoder encodes values as MessagePack with the smallest
+// representation of each value
+type msgpackEncoder struct {
+	buf []byte
+}
+
+// marshalMsgpack encodes the value as MessagePack
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	e := &msgpackEncoder{}
+	if err := encodeValue(e, reflect.ValueOf(v), 0); err != nil {
+		return nil, fmt.Errorf("msgpack: %v", err)
+	}
+	return e.buf, nil
+}
+
+// length writes the type for a length using the 8, 16 or 32 bit variant. The
+// types of the variants must be consecutive.
+func (e *msgpackEncoder) length(first byte, n int, has8 bool) {
+	switch {
+	case has8 && n <= math.MaxUint8:
+		e.buf = append(e.buf, first, byte(n))
+	case n <= math.MaxUint16:
+		if has8 {
+			first++
+		}
+		e.buf = append(e.buf, first)
+		e.buf = appendUint16(e.buf, uint16(n))
+	default:
+		if has8 {
+			first++
+		}
+		e.buf = append(e.buf, first+1)
+		e.buf = appendUint32(e.buf, uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) null() { e.buf = append(e.buf, 0xc0) }
+
+func (e *msgpackEncoder) boolean(b bool) {
+	if b {
+		e.buf = append(e.buf, 0xc3)
+		return
+	}
+	e.buf = append(e.buf, 0xc2)
+}
+
+func (e *msgpackEncoder) int(n int64) {
+	switch {
+	case n >= 0:
+		e.uint(uint64(n))
+	case n >= -32:
+		e.buf = append(e.buf, byte(n))
+	case n >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		e.buf = append(e.buf, 0xd1)
+		e.buf = appendUint16(e.buf, uint16(n))
+	case n >= math.MinInt32:
+		e.buf = append(e.buf, 0xd2)
+		e.buf = appendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xd3)
+		e.buf = appendUint64(e.buf, uint64(n))
+	}
+}
+
+func (e *msgpackEncoder) uint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.buf = append(e.buf, byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xcd)
+		e.buf = appendUint16(e.buf, uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, 0xce)
+		e.buf = appendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xcf)
+		e.buf = appendUint64(e.buf, n)
+	}
+}
+
+func (e *msgpackEncoder) float(f float64) {
+	if isFloat32(f) {
+		e.buf = append(e.buf, 0xca)
+		e.buf = appendUint32(e.buf, math.Float32bits(float32(f)))
+		return
+	}
+	e.buf = append(e.buf, 0xcb)
+	e.buf = appendUint64(e.buf, math.Float64bits(f))
+}
+
+func (e *msgpackEncoder) str(s string) {
+	if len(s) < 32 {
+		e.buf = append(e.buf, 0xa0|byte(len(s)))
+	} else {
+		e.length(0xd9, len(s), true)
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) bytes(b []byte) {
+	e.length(0xc4, len(b), true)
+	e.buf = append(e.buf, b...)
+}
+
+func (e *msgpackEncoder) array(n int) {
+	if n < 16 {
+		e.buf = append(e.buf, 0x90|byte(n))
+		return
+	}
+	e.length(0xdc, n, false)
+}
+
+func (e *msgpackEncoder) mapping(n int) {
+	if n < 16 {
+		e.buf = append(e.buf, 0x80|byte(n))
+		return
+	}
+	e.length(0xde, n, false)
+}
+
+func appendUint16(b []byte, n uint16) []byte {
+	return append(b, byte(n>>8), byte(n))
+}
+
+func appendUint32(b []byte, n uint32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(n>>32)), uint32(n))
+}
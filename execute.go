@@ -0,0 +1,281 @@
+package goplate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrOutputLimit is returned by ExecuteContext when the output exceeds
+// MaxOutputBytes. The output is truncated at the limit. The error isn't
+// wrapped in a WriteError.
+var ErrOutputLimit = errors.New("output limit exceeded")
+
+// ErrLoopLimit is reserved for MaxLoopIterations. Templates have no loops
+// yet so it isn't returned.
+var ErrLoopLimit = errors.New("loop iteration limit exceeded")
+
+// ErrIncludeDepth is returned by ExecuteContext when partials are nested
+// deeper than MaxIncludeDepth
+var ErrIncludeDepth = errors.New("include depth limit exceeded")
+
+// WriteError is returned when the writer fails. Written is the number of
+// bytes written before the error.
+type WriteError struct {
+	Written int64
+	Err     error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("write error after %d bytes: %v", e.Written, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// countingWriter counts the bytes written and wraps errors in a WriteError
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if err != nil {
+		return n, &WriteError{Written: c.n, Err: err}
+	}
+	return n, nil
+}
+
+func (c *countingWriter) WriteString(s string) (int, error) {
+	n, err := io.WriteString(c.w, s)
+	c.n += int64(n)
+	if err != nil {
+		return n, &WriteError{Written: c.n, Err: err}
+	}
+	return n, nil
+}
+
+// ExecuteOptions limits the resources used by ExecuteContext. Zero values
+// mean no limit.
+type ExecuteOptions struct {
+	// MaxOutputBytes is the maximum number of bytes written
+	MaxOutputBytes int64
+	// MaxLoopIterations is the maximum number of iterations for all loops
+	// in the template, including loops in partials. Templates have no loops
+	// yet so it has no effect.
+	MaxLoopIterations int
+	// MaxIncludeDepth is the maximum number of nested partials
+	MaxIncludeDepth int
+	// Locale overrides the template's locale for the execution, ie "de-DE"
+	Locale string
+}
+
+// execLimits holds the context and limits for an execution. It is shared by
+// the template and the partials it includes.
+type execLimits struct {
+	ctx  context.Context
+	opts ExecuteOptions
+	// out is the writer counting the output, nil if there is no limit
+	out   *limitWriter
+	depth int
+}
+
+// check returns an error if the output limit is reached or the context is
+// done
+func (l *execLimits) check() error {
+	if l.out != nil && l.out.err != nil {
+		return l.out.err
+	}
+	return l.ctx.Err()
+}
+
+// limitWriter writes up to a number of bytes and fails after that
+type limitWriter struct {
+	w         io.Writer
+	remaining int64
+	err       error
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.remaining {
+		n, _ := w.w.Write(p[:w.remaining])
+		w.remaining -= int64(n)
+		w.err = ErrOutputLimit
+		return n, w.err
+	}
+	n, err := w.w.Write(p)
+	w.remaining -= int64(n)
+	return n, err
+}
+
+// maxPooledBuffer is the largest buffer kept in the pool. Larger buffers are
+// left to the garbage collector so a single large output doesn't pin memory.
+const maxPooledBuffer = 64 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return &bytes.Buffer{} },
+}
+
+var appendWriterPool = sync.Pool{
+	New: func() interface{} { return &appendWriter{} },
+}
+
+// appendWriter is an io.Writer appending to a byte slice
+type appendWriter struct {
+	buf []byte
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *appendWriter) WriteString(s string) (int, error) {
+	w.buf = append(w.buf, s...)
+	return len(s), nil
+}
+
+// newState returns an execution state from the template's pool
+func (t *Template) newState(writer io.Writer, params interface{}) *execState {
+	state, ok := t.states.Get().(*execState)
+	if !ok {
+		state = &execState{}
+		if t.variableCount > 0 {
+			state.vars = make([]interface{}, t.variableCount)
+		}
+	}
+	state.writer = writer
+	state.params = params
+	state.localeTag = t.localeTag
+	state.locale = t.locale
+	return state
+}
+
+// countOutput makes the state count the bytes written to the writer
+func (state *execState) countOutput(writer io.Writer) {
+	state.out = countingWriter{w: writer}
+	state.writer = &state.out
+}
+
+// releaseState returns the state to the pool. References to the parameters
+// and variable values are cleared first.
+func (t *Template) releaseState(state *execState) {
+	state.writer = nil
+	state.out = countingWriter{}
+	state.params = nil
+	state.limits = nil
+	state.localeTag = ""
+	state.locale = nil
+	for i := range state.vars {
+		state.vars[i] = nil
+	}
+	t.states.Put(state)
+}
+
+// ExecuteContext writes the expanded template to the writer like Execute.
+// The execution stops with the context's error when the context is done and
+// with ErrOutputLimit or ErrIncludeDepth when one of the limits
+// in the options is reached. The locale in the options is used by the
+// template and the partials it includes.
+func (t *Template) ExecuteContext(ctx context.Context, writer io.Writer, params interface{}, opts ExecuteOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	localeTag, locale := t.localeTag, t.locale
+	if opts.Locale != "" {
+		var err error
+		if locale, err = LookupLocale(opts.Locale); err != nil {
+			return err
+		}
+		localeTag = opts.Locale
+	}
+	limits := &execLimits{ctx: ctx, opts: opts}
+	if opts.MaxOutputBytes > 0 {
+		limits.out = &limitWriter{w: writer, remaining: opts.MaxOutputBytes}
+		writer = limits.out
+	}
+	state := t.newState(writer, params)
+	state.countOutput(writer)
+	state.limits = limits
+	state.localeTag = localeTag
+	state.locale = locale
+	defer t.releaseState(state)
+	if err := executeFuncs(t.renderingFunctions, state); err != nil {
+		if limits.out != nil && limits.out.err != nil {
+			// The limit isn't a failure of the caller's writer
+			return limits.out.err
+		}
+		return err
+	}
+	return limits.check()
+}
+
+// executePartial renders the template as a partial included by another
+// template. The partial shares the writer, limits and locale with the parent.
+func (t *Template) executePartial(parent *execState, params interface{}) error {
+	limits := parent.limits
+	if limits != nil {
+		if limits.opts.MaxIncludeDepth > 0 && limits.depth >= limits.opts.MaxIncludeDepth {
+			return ErrIncludeDepth
+		}
+		limits.depth++
+		defer func() { limits.depth-- }()
+	}
+	state := t.newState(parent.writer, params)
+	state.limits = limits
+	state.localeTag = parent.localeTag
+	state.locale = parent.locale
+	defer t.releaseState(state)
+	return executeFuncs(t.renderingFunctions, state)
+}
+
+// AppendTo appends the expanded template to dst and returns the extended
+// slice. The original slice is returned if the template fails to execute.
+func (t *Template) AppendTo(dst []byte, params interface{}) ([]byte, error) {
+	if cap(dst)-len(dst) < t.sizeHint {
+		buf := make([]byte, len(dst), len(dst)+t.sizeHint)
+		copy(buf, dst)
+		dst = buf
+	}
+	w := appendWriterPool.Get().(*appendWriter)
+	w.buf = dst
+	err := t.Execute(w, params)
+	ret := w.buf
+	w.buf = nil
+	appendWriterPool.Put(w)
+	if err != nil {
+		return dst, err
+	}
+	return ret, nil
+}
+
+// ExecuteBytes returns the expanded template as a byte slice
+func (t *Template) ExecuteBytes(params interface{}) ([]byte, error) {
+	buf, err := t.AppendTo(nil, params)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// ExecuteString returns the expanded template as a string
+func (t *Template) ExecuteString(params interface{}) (string, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			bufferPool.Put(buf)
+		}
+	}()
+	buf.Grow(t.sizeHint)
+	if err := t.Execute(buf, params); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,156 @@
+package goplate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteHelpers(t *testing.T) {
+	assert := require.New(t)
+
+	tmpl, err := New(`devices/{{ $n := int32 * 2 }}{{ $n }}/{{ string }}/up`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	assert.Equal(len("devices///up"), tmpl.sizeHint)
+
+	params := &testStructure{Int32: 21, String: "x"}
+	s, err := tmpl.ExecuteString(params)
+	assert.NoError(err)
+	assert.Equal("devices/42/x/up", s)
+
+	b, err := tmpl.ExecuteBytes(params)
+	assert.NoError(err)
+	assert.Equal("devices/42/x/up", string(b))
+
+	b, err = tmpl.AppendTo([]byte("topic: "), params)
+	assert.NoError(err)
+	assert.Equal("topic: devices/42/x/up", string(b))
+
+	// Reused states don't leak values between executions
+	s, err = tmpl.ExecuteString(&testStructure{Int32: 1})
+	assert.NoError(err)
+	assert.Equal("devices/2//up", s)
+
+	// Appending to a buffer with room for the output allocates no more than
+	// executing the template does
+	dst := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		dst, _ = tmpl.AppendTo(dst[:0], params)
+	})
+	assert.Equal(testing.AllocsPerRun(100, func() {
+		_ = tmpl.Execute(io.Discard, params)
+	}), allocs)
+
+	tmpl, err = New(`{{ 1 / int32 }}`).WithParameters(&testStructure{}).WithStrictMode().Build()
+	assert.NoError(err)
+	_, err = tmpl.ExecuteString(&testStructure{})
+	assert.Error(err)
+	b, err = tmpl.AppendTo([]byte("x"), &testStructure{})
+	assert.Error(err)
+	assert.Equal("x", string(b))
+}
+
+func BenchmarkExecuteString(b *testing.B) {
+	tmpl, err := New(`tenants/{{ substructure.string }}/devices/{{ int32 }}/up`).WithParameters(&testStructure{}).Build()
+	if err != nil {
+		b.FailNow()
+	}
+	params := &testStructure{Int32: 1}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tmpl.ExecuteString(params); err != nil {
+			b.Fatalf("Error: %v", err)
+		}
+	}
+}
+
+func TestExecuteContext(t *testing.T) {
+	assert := require.New(t)
+
+	tmpl, err := New(`{{ int32 }},{{ int32 + 1 }},{{ int32 + 2 }},{{ include "p" }}`).
+		WithParameters(&testStructure{}).
+		WithPartial("p", `<{{ template "q" substructure }}>`).
+		WithPartial("q", `{{ bool }}`).
+		Build()
+	assert.NoError(err)
+	params := &testStructure{Int32: 1, Substructure: &testSubStructure{Bool: true}}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(tmpl.ExecuteContext(context.Background(), buf, params, ExecuteOptions{MaxOutputBytes: 12, MaxLoopIterations: 3, MaxIncludeDepth: 2}))
+	assert.Equal("1,2,3,<true>", buf.String())
+
+	buf.Reset()
+	err = tmpl.ExecuteContext(context.Background(), buf, params, ExecuteOptions{MaxOutputBytes: 5})
+	assert.Equal(ErrOutputLimit, err)
+	assert.Equal("1,2,3", buf.String())
+
+	// There are no loops so the loop limit is never reached
+	assert.NoError(tmpl.ExecuteContext(context.Background(), io.Discard, params, ExecuteOptions{MaxLoopIterations: 1}))
+
+	buf.Reset()
+	err = tmpl.ExecuteContext(context.Background(), buf, params, ExecuteOptions{MaxIncludeDepth: 1})
+	assert.True(errors.Is(err, ErrIncludeDepth))
+	assert.Equal("1,2,3,<", buf.String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = tmpl.ExecuteContext(ctx, io.Discard, params, ExecuteOptions{})
+	assert.True(errors.Is(err, context.Canceled))
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	err = tmpl.ExecuteContext(ctx, io.Discard, params, ExecuteOptions{})
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+
+	// The limits don't apply to executions without a context
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, params))
+	assert.Equal("1,2,3,<true>", buf.String())
+}
+
+// failingWriter accepts a number of bytes and fails after that
+type failingWriter struct {
+	remaining int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.remaining {
+		n := w.remaining
+		w.remaining = 0
+		return n, errWriteFailed
+	}
+	w.remaining -= len(p)
+	return len(p), nil
+}
+
+func TestWriteErrors(t *testing.T) {
+	assert := require.New(t)
+
+	tmpl, err := New(`{{ string }}/{{ include "p" }}/{{ int32 * 2 }}`).
+		WithParameters(&testStructure{}).
+		WithPartial("p", `{{ int32 }}`).
+		Build()
+	assert.NoError(err)
+	params := &testStructure{String: "abc", Int32: 21}
+
+	for _, n := range []int{0, 2, 4, 5, 6, 7} {
+		err = tmpl.Execute(&failingWriter{remaining: n}, params)
+		var writeErr *WriteError
+		assert.True(errors.As(err, &writeErr), n)
+		assert.Equal(int64(n), writeErr.Written)
+		assert.True(errors.Is(err, errWriteFailed))
+	}
+	assert.NoError(tmpl.Execute(&failingWriter{remaining: 9}, params))
+
+	err = tmpl.ExecuteContext(context.Background(), &failingWriter{remaining: 3}, params, ExecuteOptions{})
+	assert.True(errors.Is(err, errWriteFailed))
+}
@@ -0,0 +1,631 @@
+package goplate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenType is the type of token found when scanning the contents of a tag
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdent
+	tokenInt
+	tokenFloat
+	tokenString
+	tokenVariable
+	tokenOperator
+)
+
+type token struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+// Operators, longest first so that "<=" is matched before "<"
+var operators = []string{":=", "==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", "|", "."}
+
+// errTagNotClosed is returned by the lexer if the input ends before the right
+// delimiter
+var errTagNotClosed = errors.New("tag isn't closed")
+
+// lineIndex is the offsets of the line starts in a string, used to turn
+// offsets into line and column numbers.
+type lineIndex []int
+
+func newLineIndex(input string) lineIndex {
+	lines := lineIndex{0}
+	for i := 0; i < len(input); i++ {
+		if input[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+func (l lineIndex) position(offset int) Pos {
+	line := sort.Search(len(l), func(i int) bool { return l[i] > offset }) - 1
+	return Pos{Offset: offset, Line: line + 1, Column: offset - l[line] + 1}
+}
+
+// lexer splits the contents of a tag into tokens. The lexer starts after the
+// left delimiter and stops after the right delimiter. Delimiters inside
+// strings don't end the tag. If the right delimiter is empty the entire input
+// is a single expression.
+type lexer struct {
+	input string
+	pos   int
+	right string
+	lines lineIndex
+}
+
+// tokenize splits an expression into tokens.
+func tokenize(expr string) ([]token, error) {
+	l := &lexer{input: expr, lines: newLineIndex(expr)}
+	tokens, _, err := l.lex()
+	return tokens, err
+}
+
+// atTagEnd checks if the lexer is at the right delimiter, optionally preceded
+// by whitespace and a trim marker. The trim marker must be separated from the
+// tag contents by whitespace so "{{ 3-}}" is a syntax error and not a trim.
+func (l *lexer) atTagEnd() (end int, trim bool, ok bool) {
+	if l.right == "" {
+		return 0, false, false
+	}
+	rest := l.input[l.pos:]
+	if strings.HasPrefix(rest, l.right) {
+		return l.pos + len(l.right), false, true
+	}
+	if len(rest) > 0 && isSpace(rest[0]) && strings.HasPrefix(rest[1:], trimMarker+l.right) {
+		return l.pos + 1 + len(trimMarker) + len(l.right), true, true
+	}
+	return 0, false, false
+}
+
+// lex returns the tokens up to the end of the tag and if the tag ends with a
+// trim marker. On errors the tokens read so far are returned and the position
+// is left at the offending token.
+func (l *lexer) lex() ([]token, bool, error) {
+	var tokens []token
+	input := l.input
+	for {
+		if end, trim, ok := l.atTagEnd(); ok {
+			tokens = append(tokens, token{typ: tokenEOF, pos: l.pos})
+			l.pos = end
+			return tokens, trim, nil
+		}
+		if l.pos >= len(input) {
+			if l.right != "" {
+				return nil, false, errTagNotClosed
+			}
+			return append(tokens, token{typ: tokenEOF, pos: l.pos}), false, nil
+		}
+
+		i := l.pos
+		ch, size := utf8.DecodeRuneInString(input[i:])
+		switch {
+		case unicode.IsSpace(ch):
+			i += size
+
+		case isIdentStart(ch):
+			start := i
+			i = l.scanIdent(i)
+			tokens = append(tokens, token{typ: tokenIdent, val: input[start:i], pos: start})
+
+		case ch == '$':
+			start := i
+			i = l.scanIdent(i + 1)
+			if i == start+1 {
+				return tokens, false, fmt.Errorf("missing variable name at %s", l.lines.position(start))
+			}
+			tokens = append(tokens, token{typ: tokenVariable, val: input[start:i], pos: start})
+
+		case unicode.IsDigit(ch):
+			start := i
+			typ := tokenInt
+			for i < len(input) && (unicode.IsDigit(rune(input[i])) || input[i] == '.') {
+				if input[i] == '.' {
+					if typ == tokenFloat {
+						return tokens, false, fmt.Errorf("malformed number at %s", l.lines.position(start))
+					}
+					typ = tokenFloat
+				}
+				i++
+			}
+			tokens = append(tokens, token{typ: typ, val: input[start:i], pos: start})
+
+		case ch == '"':
+			start := i
+			i++
+			for i < len(input) && input[i] != '"' && input[i] != '\n' {
+				if input[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(input) || input[i] != '"' {
+				return tokens, false, fmt.Errorf("string at %s isn't terminated", l.lines.position(start))
+			}
+			i++
+			str, err := strconv.Unquote(input[start:i])
+			if err != nil {
+				return tokens, false, fmt.Errorf("invalid string at %s: %v", l.lines.position(start), err)
+			}
+			tokens = append(tokens, token{typ: tokenString, val: str, pos: start})
+
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(input[i:], op) {
+					tokens = append(tokens, token{typ: tokenOperator, val: op, pos: i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return tokens, false, fmt.Errorf("unexpected character %q at %s", ch, l.lines.position(i))
+			}
+		}
+		l.pos = i
+	}
+}
+
+// scanIdent returns the end of the identifier starting at pos
+func (l *lexer) scanIdent(pos int) int {
+	for pos < len(l.input) {
+		ch, size := utf8.DecodeRuneInString(l.input[pos:])
+		if !isIdentStart(ch) && !unicode.IsDigit(ch) {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
+
+func isIdentStart(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch)
+}
+
+type actionType int
+
+const (
+	actionPipeline actionType = iota
+	actionIf
+	actionElse
+	actionEnd
+	actionAssign
+	actionInclude
+	actionBlock
+	actionDefine
+	actionExtends
+)
+
+func (a actionType) String() string {
+	switch a {
+	case actionIf:
+		return "if"
+	case actionElse:
+		return "else"
+	case actionEnd:
+		return "end"
+	case actionAssign:
+		return "assignment"
+	case actionInclude:
+		return "include"
+	case actionBlock:
+		return "block"
+	case actionDefine:
+		return "define"
+	case actionExtends:
+		return "extends"
+	default:
+		return "pipeline"
+	}
+}
+
+// isStructural checks if the action opens or closes a section. These are
+// kept even if the rest of the tag has errors so the sections still match up.
+func (a actionType) isStructural() bool {
+	switch a {
+	case actionIf, actionElse, actionEnd, actionBlock, actionDefine, actionExtends:
+		return true
+	}
+	return false
+}
+
+// namedActions are the keywords followed by a template name
+var namedActions = map[string]actionType{
+	"include":  actionInclude,
+	"template": actionInclude,
+	"block":    actionBlock,
+	"define":   actionDefine,
+	"extends":  actionExtends,
+}
+
+// actionNode is the parsed contents of a single tag. The template parser
+// turns these into the nodes in the syntax tree.
+type actionNode struct {
+	typ      actionType
+	variable string
+	// name is the name of included partials, blocks and definitions
+	name     string
+	pipeline *PipeNode
+}
+
+// The expression parser is a plain recursive descent parser. The precedence
+// is (from lowest to highest) ||, &&, comparisons, + and -, *, / and % and
+// finally the unary operators.
+type exprParser struct {
+	tokens []token
+	pos    int
+	lines  lineIndex
+}
+
+// parseAction parses a single expression without delimiters
+func parseAction(tag string) (*actionNode, error) {
+	tokens, err := tokenize(tag)
+	if err != nil {
+		return nil, err
+	}
+	return parseTokens(tokens, newLineIndex(tag))
+}
+
+// parseTokens parses the tokens of a tag. The returned action has the type
+// set even when there is an error.
+func parseTokens(tokens []token, lines lineIndex) (*actionNode, error) {
+	p := &exprParser{tokens: tokens, lines: lines}
+
+	ret := &actionNode{typ: actionPipeline}
+	if first := p.peek(); first.typ == tokenVariable && p.tokens[1].typ == tokenOperator && p.tokens[1].val == ":=" {
+		p.next()
+		p.next()
+		ret.typ = actionAssign
+		ret.variable = strings.ToLower(first.val)
+	} else if first.typ == tokenIdent {
+		if typ, ok := namedActions[first.val]; ok && p.tokens[1].typ == tokenString {
+			// These are only keywords when followed by the template name
+			ret.typ = typ
+			return ret, p.parseNamedAction(ret)
+		}
+		switch first.val {
+		case "if":
+			// if is a field unless it's followed by the condition
+			if startsOperand(p.tokens[1]) {
+				p.next()
+				ret.typ = actionIf
+			}
+		case "else", "end":
+			// else and end are only keywords on their own. The pipeline is
+			// still parsed as a field since the parser decides if they close
+			// a section or render the field.
+			if p.tokens[1].typ == tokenEOF {
+				ret.typ = actionElse
+				if first.val == "end" {
+					ret.typ = actionEnd
+				}
+			}
+		}
+	}
+	pipeline, err := p.parsePipeline()
+	if err != nil {
+		return ret, err
+	}
+	if err := p.expectEOF(); err != nil {
+		return ret, err
+	}
+	ret.pipeline = pipeline
+	return ret, nil
+}
+
+// startsOperand checks if the token can start an expression
+func startsOperand(t token) bool {
+	switch t.typ {
+	case tokenIdent, tokenInt, tokenFloat, tokenString, tokenVariable:
+		return true
+	case tokenOperator:
+		return t.val == "!" || t.val == "-" || t.val == "("
+	}
+	return false
+}
+
+// parseNamedAction parses actions with a template name. Partials included
+// with the include form uses the current parameters while the template form
+// has a field with the parameters for the partial.
+func (p *exprParser) parseNamedAction(action *actionNode) error {
+	keyword := p.next()
+	action.name = p.next().val
+	if keyword.val == "template" {
+		pipeline, err := p.parsePipeline()
+		if err != nil {
+			return err
+		}
+		action.pipeline = pipeline
+	}
+	return p.expectEOF()
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) position(t token) Pos {
+	return p.lines.position(t.pos)
+}
+
+// isOperator checks if the next token is one of the operators
+func (p *exprParser) isOperator(ops ...string) bool {
+	t := p.peek()
+	if t.typ != tokenOperator {
+		return false
+	}
+	for _, op := range ops {
+		if t.val == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	t := p.next()
+	if t.typ != tokenOperator || t.val != op {
+		if t.typ == tokenEOF {
+			return fmt.Errorf("expected %q at end of expression", op)
+		}
+		return fmt.Errorf("expected %q at %s but got %q", op, p.position(t), t.val)
+	}
+	return nil
+}
+
+// expectEOF checks that all tokens have been used
+func (p *exprParser) expectEOF() error {
+	if t := p.peek(); t.typ != tokenEOF {
+		return fmt.Errorf("unexpected %q at %s", t.val, p.position(t))
+	}
+	return nil
+}
+
+func (p *exprParser) parsePipeline() (*PipeNode, error) {
+	start := p.peek()
+	var expr Node
+	var err error
+	if start.typ == tokenIdent && start.val == "t" && p.tokens[p.pos+1].typ == tokenString {
+		// t is only a keyword when followed by the message key
+		expr, err = p.parseMessage()
+	} else {
+		expr, err = p.parseOr()
+	}
+	if err != nil {
+		return nil, err
+	}
+	ret := &PipeNode{Pos: p.position(start), Expr: expr}
+	for p.isOperator("|") {
+		p.next()
+		t := p.next()
+		if t.typ != tokenIdent {
+			return nil, fmt.Errorf("expected transform name at %s", p.position(t))
+		}
+		transform := &TransformNode{Pos: p.position(t), Name: t.val}
+		for next := p.peek(); next.typ != tokenEOF && !p.isOperator("|"); next = p.peek() {
+			arg, err := p.parseArgument()
+			if err != nil {
+				return nil, err
+			}
+			transform.Args = append(transform.Args, arg)
+		}
+		ret.Transforms = append(ret.Transforms, transform)
+	}
+	return ret, nil
+}
+
+// parseMessage parses a message with the key and the arguments up to the
+// first transform. Arguments with operators must be in parentheses.
+func (p *exprParser) parseMessage() (Node, error) {
+	keyword := p.next()
+	ret := &MessageNode{Pos: p.position(keyword), Key: p.next().val}
+	for next := p.peek(); next.typ != tokenEOF && !p.isOperator("|"); next = p.peek() {
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		ret.Args = append(ret.Args, arg)
+	}
+	return ret, nil
+}
+
+// parseArgument parses a transform argument. Arguments are literals and
+// numbers can be negative.
+func (p *exprParser) parseArgument() (*LiteralNode, error) {
+	start := p.peek()
+	negative := p.isOperator("-")
+	if negative {
+		p.next()
+	}
+	t := p.peek()
+	switch {
+	case t.typ == tokenInt || t.typ == tokenFloat || t.typ == tokenString && !negative:
+	case t.typ == tokenIdent && (t.val == "true" || t.val == "false") && !negative:
+	default:
+		return nil, fmt.Errorf("expected literal argument at %s", p.position(t))
+	}
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	lit := node.(*LiteralNode)
+	if negative {
+		lit.Pos = p.position(start)
+		switch v := lit.Value.(type) {
+		case int64:
+			lit.Value = -v
+		case float64:
+			lit.Value = -v
+		}
+	}
+	return lit, nil
+}
+
+func (p *exprParser) parseOr() (Node, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (Node, error) {
+	return p.parseBinary(p.parseComparison, "&&")
+}
+
+// parseBinary parses left-associative binary operations
+func (p *exprParser) parseBinary(operand func() (Node, error), ops ...string) (Node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator(ops...) {
+		op := p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Pos: p.position(op), Op: op.val, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// Comparisons can't be chained, ie a < b < c is an error
+func (p *exprParser) parseComparison() (Node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOperator("==", "!=", "<", ">", "<=", ">=") {
+		op := p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryNode{Pos: p.position(op), Op: op.val, Left: left, Right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdditive() (Node, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *exprParser) parseMultiplicative() (Node, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *exprParser) parseUnary() (Node, error) {
+	if p.isOperator("!", "-") {
+		op := p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryNode{Pos: p.position(op), Op: op.val, Operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (Node, error) {
+	t := p.next()
+	pos := p.position(t)
+	switch t.typ {
+	case tokenInt:
+		v, err := strconv.ParseInt(t.val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer at %s: %v", pos, err)
+		}
+		return &LiteralNode{Pos: pos, Value: v}, nil
+
+	case tokenFloat:
+		v, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number at %s: %v", pos, err)
+		}
+		return &LiteralNode{Pos: pos, Value: v}, nil
+
+	case tokenString:
+		return &LiteralNode{Pos: pos, Value: t.val}, nil
+
+	case tokenIdent:
+		switch t.val {
+		case "true":
+			return &LiteralNode{Pos: pos, Value: true}, nil
+		case "false":
+			return &LiteralNode{Pos: pos, Value: false}, nil
+		}
+		return p.parseField(t)
+
+	case tokenVariable:
+		return p.parseField(t)
+
+	case tokenOperator:
+		if t.val == "(" {
+			expr, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		}
+		return nil, fmt.Errorf("unexpected %q at %s", t.val, pos)
+
+	default:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+}
+
+// parseField parses a dot-separated field name with an optional map key.
+// Field names are case insensitive and map keys are lower case. If the first
+// token is a variable the rest of the field name is relative to the variable.
+func (p *exprParser) parseField(first token) (Node, error) {
+	ret := &FieldNode{Pos: p.position(first)}
+	var names []string
+	if first.typ == tokenVariable {
+		ret.Variable = strings.ToLower(first.val)
+	} else {
+		names = append(names, first.val)
+	}
+	for p.isOperator(".") {
+		p.next()
+		t := p.next()
+		if t.typ != tokenIdent {
+			return nil, fmt.Errorf("expected field name at %s", p.position(t))
+		}
+		names = append(names, t.val)
+	}
+	ret.Path = strings.ToLower(strings.Join(names, "."))
+	if p.isOperator("[") {
+		p.next()
+		t := p.next()
+		if t.typ != tokenString {
+			return nil, fmt.Errorf("expected map key at %s", p.position(t))
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		ret.Key = strings.ToLower(t.val)
+		ret.HasKey = true
+	}
+	return ret, nil
+}
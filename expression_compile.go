@@ -0,0 +1,745 @@
+package goplate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// valueKind is the type of a value in an expression
+type valueKind int
+
+const (
+	invalidKind valueKind = iota
+	boolKind
+	intKind
+	floatKind
+	stringKind
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case boolKind:
+		return "bool"
+	case intKind:
+		return "int"
+	case floatKind:
+		return "float"
+	case stringKind:
+		return "string"
+	default:
+		return "invalid"
+	}
+}
+
+// value is the result of an expression. Integer types are widened to int64
+// and floats to float64 so the expressions only have to deal with four types.
+type value struct {
+	kind valueKind
+	b    bool
+	i    int64
+	f    float64
+	s    string
+}
+
+func boolValue(v bool) value      { return value{kind: boolKind, b: v} }
+func intValue(v int64) value      { return value{kind: intKind, i: v} }
+func floatValue(v float64) value  { return value{kind: floatKind, f: v} }
+func stringValue(v string) value  { return value{kind: stringKind, s: v} }
+func zeroValue(k valueKind) value { return value{kind: k} }
+
+// asFloat returns the value as a float, converting integers if required
+func (v value) asFloat() float64 {
+	if v.kind == intKind {
+		return float64(v.i)
+	}
+	return v.f
+}
+
+// String returns the value formatted for output
+func (v value) String() string {
+	switch v.kind {
+	case boolKind:
+		return strconv.FormatBool(v.b)
+	case intKind:
+		return strconv.FormatInt(v.i, 10)
+	case floatKind:
+		return strconv.FormatFloat(v.f, 'f', -1, 64)
+	case stringKind:
+		return v.s
+	default:
+		return ""
+	}
+}
+
+// Interface returns the value as a regular Go type for transforms
+func (v value) Interface() interface{} {
+	switch v.kind {
+	case boolKind:
+		return v.b
+	case intKind:
+		return v.i
+	case floatKind:
+		return v.f
+	case stringKind:
+		return v.s
+	default:
+		return nil
+	}
+}
+
+// ErrDivisionByZero is returned by strict templates when an expression divides
+// by zero
+var ErrDivisionByZero = errors.New("division by zero")
+
+// ErrOverflow is returned by strict templates when an arithmetic operation
+// overflows
+var ErrOverflow = errors.New("arithmetic overflow")
+
+// evalFunc evaluates a compiled expression
+type evalFunc func(state *execState) (value, error)
+
+// compiledExpr is an expression that has been type checked
+type compiledExpr struct {
+	kind valueKind
+	eval evalFunc
+}
+
+// exprCompiler type checks expressions against the fields in the digger and
+// turns them into evaluation functions.
+type exprCompiler struct {
+	digger *structDigger
+	// strict makes overflows and division by zero errors. If it isn't set
+	// integers wrap around, integer division by zero returns 0 and float
+	// operations follows IEEE 754.
+	strict bool
+	scopes []map[string]*variable
+	slots  int
+	// references are the fields resolved by the compiler. The template is the
+	// name of the partial or base template being compiled.
+	references     []Reference
+	usedTransforms []string
+	template       string
+	// catalog has the messages for message expressions, it is nil if the
+	// template has no catalog
+	catalog *Catalog
+}
+
+// variable is a template-local variable. Variables bound to a field keep the
+// field's lookup info so fields relative to the variable can be type checked.
+// Variables with the result of an expression just have the kind.
+type variable struct {
+	slot int
+	info *lookupInfo
+	kind valueKind
+}
+
+func newExprCompiler(digger *structDigger, strict bool, catalog *Catalog) *exprCompiler {
+	return &exprCompiler{
+		digger:  digger,
+		catalog: catalog,
+		strict:  strict,
+		scopes:  []map[string]*variable{make(map[string]*variable)},
+	}
+}
+
+// pushScope starts a new variable scope, ie when entering a block
+func (c *exprCompiler) pushScope() {
+	c.scopes = append(c.scopes, make(map[string]*variable))
+}
+
+// popScope drops the variables declared in the current scope
+func (c *exprCompiler) popScope() {
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+// declare adds a variable to the current scope. Variables in outer scopes
+// can be shadowed but not redeclared in the same scope.
+func (c *exprCompiler) declare(name string, info *lookupInfo, kind valueKind) (*variable, error) {
+	scope := c.scopes[len(c.scopes)-1]
+	if _, exists := scope[name]; exists {
+		return nil, fmt.Errorf("%s is already declared", name)
+	}
+	v := &variable{slot: c.slots, info: info, kind: kind}
+	c.slots++
+	scope[name] = v
+	return v, nil
+}
+
+func (c *exprCompiler) lookupVariable(name string) (*variable, error) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if v, ok := c.scopes[i][name]; ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not declared", name)
+}
+
+// isComputedVariable checks if the field is a reference to a variable with
+// the result of an expression
+func (c *exprCompiler) isComputedVariable(n *FieldNode) bool {
+	if n.Variable == "" {
+		return false
+	}
+	v, err := c.lookupVariable(n.Variable)
+	return err == nil && v.info == nil
+}
+
+// resolveField looks up the field and returns the lookup info plus a
+// function to retrieve the raw field value. Fields relative to a variable are
+// checked against the sub-tree the variable points to.
+func (c *exprCompiler) resolveField(n *FieldNode) (*lookupInfo, func(*execState) interface{}, error) {
+	digger := c.digger
+	if n.Variable == "" {
+		info := digger.findField(n.Path)
+		if info == nil {
+			return nil, nil, fmt.Errorf("%s is not a known expression", n.Path)
+		}
+		digger.KeepField(n.Path)
+		c.addReference(n, info)
+		return info, func(state *execState) interface{} {
+			return digger.retrieveFieldValue(state.params, 0, info)
+		}, nil
+	}
+
+	v, err := c.lookupVariable(n.Variable)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v.info == nil {
+		return nil, nil, fmt.Errorf("%s is a %s and has no fields", n.Variable, v.kind)
+	}
+	name := v.info.FieldName
+	if n.Path != "" {
+		name += "." + n.Path
+	}
+	info := digger.findField(name)
+	if info == nil {
+		return nil, nil, fmt.Errorf("%s is not a known expression", n)
+	}
+	digger.KeepField(name)
+	c.addReference(n, info)
+	slot, depth := v.slot, len(v.info.FieldIndex)
+	return info, func(state *execState) interface{} {
+		root := state.vars[slot]
+		if root == nil {
+			return nil
+		}
+		return digger.retrieveFieldValue(root, depth, info)
+	}, nil
+}
+
+// addReference records a resolved field
+func (c *exprCompiler) addReference(n *FieldNode, info *lookupInfo) {
+	ref := Reference{
+		Path:     info.FieldName,
+		Key:      n.Key,
+		HasKey:   n.HasKey,
+		Template: c.template,
+		Pos:      n.Pos,
+		Type:     info.Type,
+	}
+	if n.HasKey && info.IsMap {
+		ref.Type = info.Type.Elem()
+	}
+	c.references = append(c.references, ref)
+}
+
+// addTransforms records the transforms used in a pipeline and sets the
+// transform chain for the reference if the pipeline is a single field. The
+// start is the number of references before the pipeline was compiled.
+func (c *exprCompiler) addTransforms(pipeline *PipeNode, start int) {
+	var names []string
+	for _, t := range pipeline.Transforms {
+		names = append(names, t.Name)
+		c.useTransform(t.Name)
+	}
+	if _, ok := pipeline.Expr.(*FieldNode); ok && len(c.references) == start+1 {
+		c.references[start].Transforms = names
+	}
+}
+
+// useTransform records the use of a transform
+func (c *exprCompiler) useTransform(name string) {
+	for _, n := range c.usedTransforms {
+		if n == name {
+			return
+		}
+	}
+	c.usedTransforms = append(c.usedTransforms, name)
+}
+
+// compileAssignment compiles the right hand side of an assignment and
+// declares the variable. Plain field references bind the variable to the
+// field so fields relative to the variable can be used later.
+func (c *exprCompiler) compileAssignment(name string, pipeline *PipeNode) (func(*execState) error, error) {
+	if len(pipeline.Transforms) > 0 {
+		return nil, errors.New("transforms can't be used in assignments")
+	}
+	if n, ok := pipeline.Expr.(*FieldNode); ok && !n.HasKey && !c.isComputedVariable(n) {
+		info, get, err := c.resolveField(n)
+		if err != nil {
+			return nil, err
+		}
+		v, err := c.declare(name, info, invalidKind)
+		if err != nil {
+			return nil, err
+		}
+		slot := v.slot
+		return func(state *execState) error {
+			state.vars[slot] = get(state)
+			return nil
+		}, nil
+	}
+
+	expr, err := c.compile(pipeline.Expr)
+	if err != nil {
+		return nil, err
+	}
+	v, err := c.declare(name, nil, expr.kind)
+	if err != nil {
+		return nil, err
+	}
+	slot, eval := v.slot, expr.eval
+	return func(state *execState) error {
+		val, err := eval(state)
+		state.vars[slot] = val
+		return err
+	}, nil
+}
+
+// valueConverter returns a function that converts field values of the type
+// into expression values. The type switch is done here when the template is
+// built so the returned functions only do a type assertion.
+func valueConverter(t reflect.Type) (valueKind, func(interface{}) value) {
+	switch t {
+	case reflect.TypeOf(&wrapperspb.StringValue{}):
+		return stringKind, func(v interface{}) value { return stringValue(v.(*wrapperspb.StringValue).Value) }
+	case reflect.TypeOf(&wrapperspb.Int32Value{}):
+		return intKind, func(v interface{}) value { return intValue(int64(v.(*wrapperspb.Int32Value).Value)) }
+	case reflect.TypeOf(&wrapperspb.Int64Value{}):
+		return intKind, func(v interface{}) value { return intValue(v.(*wrapperspb.Int64Value).Value) }
+	case reflect.TypeOf(&wrapperspb.BoolValue{}):
+		return boolKind, func(v interface{}) value { return boolValue(v.(*wrapperspb.BoolValue).Value) }
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return stringKind, func(v interface{}) value { return stringValue(v.(string)) }
+	case reflect.Bool:
+		return boolKind, func(v interface{}) value { return boolValue(v.(bool)) }
+	case reflect.Int:
+		return intKind, func(v interface{}) value { return intValue(int64(v.(int))) }
+	case reflect.Int16:
+		return intKind, func(v interface{}) value { return intValue(int64(v.(int16))) }
+	case reflect.Int32:
+		return intKind, func(v interface{}) value { return intValue(int64(v.(int32))) }
+	case reflect.Int64:
+		return intKind, func(v interface{}) value { return intValue(v.(int64)) }
+	case reflect.Float32:
+		return floatKind, func(v interface{}) value { return floatValue(float64(v.(float32))) }
+	case reflect.Float64:
+		return floatKind, func(v interface{}) value { return floatValue(v.(float64)) }
+	}
+	return invalidKind, nil
+}
+
+// literalValue converts a literal to a value
+func literalValue(n *LiteralNode) (value, error) {
+	switch v := n.Value.(type) {
+	case bool:
+		return boolValue(v), nil
+	case int64:
+		return intValue(v), nil
+	case float64:
+		return floatValue(v), nil
+	case string:
+		return stringValue(v), nil
+	}
+	return value{}, fmt.Errorf("unsupported literal %T at %s", n.Value, n.Pos)
+}
+
+// compile type checks the expression and returns a function to evaluate it.
+func (c *exprCompiler) compile(node Node) (compiledExpr, error) {
+	switch n := node.(type) {
+	case *LiteralNode:
+		val, err := literalValue(n)
+		if err != nil {
+			return compiledExpr{}, err
+		}
+		return compiledExpr{kind: val.kind, eval: func(*execState) (value, error) { return val, nil }}, nil
+
+	case *FieldNode:
+		return c.compileField(n)
+
+	case *MessageNode:
+		return c.compileMessage(n)
+
+	case *UnaryNode:
+		operand, err := c.compile(n.Operand)
+		if err != nil {
+			return compiledExpr{}, err
+		}
+		return c.compileUnary(n, operand)
+
+	case *BinaryNode:
+		left, err := c.compile(n.Left)
+		if err != nil {
+			return compiledExpr{}, err
+		}
+		right, err := c.compile(n.Right)
+		if err != nil {
+			return compiledExpr{}, err
+		}
+		return c.compileBinary(n, left, right)
+	}
+	return compiledExpr{}, fmt.Errorf("unknown expression at %s", node.Position())
+}
+
+func (c *exprCompiler) compileField(n *FieldNode) (compiledExpr, error) {
+	if c.isComputedVariable(n) {
+		v, _ := c.lookupVariable(n.Variable)
+		if n.HasKey || n.Path != "" {
+			return compiledExpr{}, fmt.Errorf("%s is a %s and has no fields", n.Variable, v.kind)
+		}
+		slot := v.slot
+		return compiledExpr{kind: v.kind, eval: func(state *execState) (value, error) {
+			return state.vars[slot].(value), nil
+		}}, nil
+	}
+
+	info, get, err := c.resolveField(n)
+	if err != nil {
+		return compiledExpr{}, err
+	}
+	name := n.String()
+	if n.HasKey {
+		if !info.IsMap || info.Type.Key().Kind() != reflect.String || info.Type.Elem().Kind() != reflect.String {
+			return compiledExpr{}, fmt.Errorf("%s is not a map of strings", name)
+		}
+		key := n.Key
+		return compiledExpr{kind: stringKind, eval: func(state *execState) (value, error) {
+			m, _ := get(state).(map[string]string)
+			return stringValue(m[key]), nil
+		}}, nil
+	}
+	if !info.IsLeaf || info.IsMap {
+		return compiledExpr{}, fmt.Errorf("%s can't be used in expressions", name)
+	}
+	kind, conv := valueConverter(info.Type)
+	if kind == invalidKind {
+		return compiledExpr{}, fmt.Errorf("%s (%s) can't be used in expressions", name, info.Type)
+	}
+	return compiledExpr{kind: kind, eval: func(state *execState) (value, error) {
+		v := get(state)
+		if v == nil {
+			return zeroValue(kind), nil
+		}
+		return conv(v), nil
+	}}, nil
+}
+
+// compileMessage compiles a message from the catalog. The message must be
+// in the catalog for at least one locale and the number of arguments must
+// match the message.
+func (c *exprCompiler) compileMessage(n *MessageNode) (compiledExpr, error) {
+	catalog := c.catalog
+	if catalog == nil {
+		return compiledExpr{}, fmt.Errorf("message %q at %s: the template has no catalog", n.Key, n.Pos)
+	}
+	count, ok := catalog.argCount(n.Key)
+	if !ok {
+		return compiledExpr{}, fmt.Errorf("message %q at %s isn't in the catalog", n.Key, n.Pos)
+	}
+	if len(n.Args) < count {
+		return compiledExpr{}, fmt.Errorf("message %q at %s needs %d arguments but got %d", n.Key, n.Pos, count, len(n.Args))
+	}
+	args := make([]evalFunc, len(n.Args))
+	for i, arg := range n.Args {
+		expr, err := c.compile(arg)
+		if err != nil {
+			return compiledExpr{}, err
+		}
+		args[i] = expr.eval
+	}
+	key := n.Key
+	return compiledExpr{kind: stringKind, eval: func(state *execState) (value, error) {
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			v, err := arg(state)
+			if err != nil {
+				return value{}, err
+			}
+			values[i] = v.Interface()
+		}
+		return stringValue(catalog.format(state.localeTag, state.locale, key, values)), nil
+	}}, nil
+}
+
+func (c *exprCompiler) compileUnary(n *UnaryNode, operand compiledExpr) (compiledExpr, error) {
+	eval := operand.eval
+	switch {
+	case n.Op == "!" && operand.kind == boolKind:
+		return compiledExpr{kind: boolKind, eval: func(state *execState) (value, error) {
+			v, err := eval(state)
+			return boolValue(!v.b), err
+		}}, nil
+
+	case n.Op == "-" && operand.kind == floatKind:
+		return compiledExpr{kind: floatKind, eval: func(state *execState) (value, error) {
+			v, err := eval(state)
+			return floatValue(-v.f), err
+		}}, nil
+
+	case n.Op == "-" && operand.kind == intKind:
+		strict, pos := c.strict, n.Pos
+		return compiledExpr{kind: intKind, eval: func(state *execState) (value, error) {
+			v, err := eval(state)
+			if err != nil {
+				return v, err
+			}
+			if strict && v.i == math.MinInt64 {
+				return v, fmt.Errorf("%w at %s", ErrOverflow, pos)
+			}
+			return intValue(-v.i), nil
+		}}, nil
+	}
+	return compiledExpr{}, fmt.Errorf("operator %s at %s can't be used with %s", n.Op, n.Pos, operand.kind)
+}
+
+func isNumeric(k valueKind) bool {
+	return k == intKind || k == floatKind
+}
+
+// evalBoth evaluates both operands in a binary operation
+func evalBoth(l, r evalFunc, state *execState) (value, value, error) {
+	a, err := l(state)
+	if err != nil {
+		return a, a, err
+	}
+	b, err := r(state)
+	return a, b, err
+}
+
+func (c *exprCompiler) compileBinary(n *BinaryNode, left, right compiledExpr) (compiledExpr, error) {
+	l, r := left.eval, right.eval
+	switch n.Op {
+	case "&&", "||":
+		if left.kind != boolKind || right.kind != boolKind {
+			return compiledExpr{}, fmt.Errorf("operator %s at %s requires bool operands but got %s and %s", n.Op, n.Pos, left.kind, right.kind)
+		}
+		// The right hand side is only evaluated if required
+		shortCircuit := n.Op == "||"
+		return compiledExpr{kind: boolKind, eval: func(state *execState) (value, error) {
+			a, err := l(state)
+			if err != nil || a.b == shortCircuit {
+				return a, err
+			}
+			return r(state)
+		}}, nil
+
+	case "+", "-", "*", "/", "%":
+		return c.compileArithmetic(n, left, right)
+	}
+
+	// The rest are comparisons
+	cmp, err := comparator(n, left.kind, right.kind)
+	if err != nil {
+		return compiledExpr{}, err
+	}
+	var test func(int) bool
+	switch n.Op {
+	case "==":
+		test = func(c int) bool { return c == 0 }
+	case "!=":
+		test = func(c int) bool { return c != 0 }
+	case "<":
+		test = func(c int) bool { return c == -1 }
+	case ">":
+		test = func(c int) bool { return c == 1 }
+	case "<=":
+		test = func(c int) bool { return c == -1 || c == 0 }
+	case ">=":
+		test = func(c int) bool { return c == 1 || c == 0 }
+	default:
+		return compiledExpr{}, fmt.Errorf("unknown operator %s at %s", n.Op, n.Pos)
+	}
+	return compiledExpr{kind: boolKind, eval: func(state *execState) (value, error) {
+		a, b, err := evalBoth(l, r, state)
+		if err != nil {
+			return a, err
+		}
+		return boolValue(test(cmp(a, b))), nil
+	}}, nil
+}
+
+// compileArithmetic compiles an arithmetic operation. If both operands are
+// integers the result is an integer, otherwise both operands are promoted to
+// floats.
+func (c *exprCompiler) compileArithmetic(n *BinaryNode, left, right compiledExpr) (compiledExpr, error) {
+	if !isNumeric(left.kind) || !isNumeric(right.kind) {
+		return compiledExpr{}, fmt.Errorf("operator %s at %s requires numeric operands but got %s and %s", n.Op, n.Pos, left.kind, right.kind)
+	}
+	l, r := left.eval, right.eval
+	strict, pos, isDivision := c.strict, n.Pos, n.Op == "/" || n.Op == "%"
+
+	if left.kind == intKind && right.kind == intKind {
+		op := intOperation(n.Op)
+		return compiledExpr{kind: intKind, eval: func(state *execState) (value, error) {
+			a, b, err := evalBoth(l, r, state)
+			if err != nil {
+				return a, err
+			}
+			ret, err := op(a.i, b.i, strict)
+			if err != nil {
+				return a, fmt.Errorf("%w at %s", err, pos)
+			}
+			return intValue(ret), nil
+		}}, nil
+	}
+
+	op := floatOperation(n.Op)
+	return compiledExpr{kind: floatKind, eval: func(state *execState) (value, error) {
+		a, b, err := evalBoth(l, r, state)
+		if err != nil {
+			return a, err
+		}
+		af, bf := a.asFloat(), b.asFloat()
+		if strict && bf == 0 && isDivision {
+			return a, fmt.Errorf("%w at %s", ErrDivisionByZero, pos)
+		}
+		ret := op(af, bf)
+		if strict && math.IsInf(ret, 0) && !math.IsInf(af, 0) && !math.IsInf(bf, 0) {
+			return a, fmt.Errorf("%w at %s", ErrOverflow, pos)
+		}
+		return floatValue(ret), nil
+	}}, nil
+}
+
+// intOperation returns the integer operation for the operator. The
+// operations check for overflow and division by zero in strict mode.
+func intOperation(op string) func(a, b int64, strict bool) (int64, error) {
+	switch op {
+	case "+":
+		return func(a, b int64, strict bool) (int64, error) {
+			ret := a + b
+			if strict && (a > 0 && b > 0 && ret < 0 || a < 0 && b < 0 && ret >= 0) {
+				return 0, ErrOverflow
+			}
+			return ret, nil
+		}
+	case "-":
+		return func(a, b int64, strict bool) (int64, error) {
+			ret := a - b
+			if strict && (a >= 0 && b < 0 && ret < 0 || a < 0 && b > 0 && ret >= 0) {
+				return 0, ErrOverflow
+			}
+			return ret, nil
+		}
+	case "*":
+		return func(a, b int64, strict bool) (int64, error) {
+			ret := a * b
+			if strict && a != 0 && (ret/a != b || a == -1 && b == math.MinInt64 || b == -1 && a == math.MinInt64) {
+				return 0, ErrOverflow
+			}
+			return ret, nil
+		}
+	case "/":
+		return func(a, b int64, strict bool) (int64, error) {
+			if b == 0 {
+				if strict {
+					return 0, ErrDivisionByZero
+				}
+				return 0, nil
+			}
+			if a == math.MinInt64 && b == -1 && strict {
+				return 0, ErrOverflow
+			}
+			return a / b, nil
+		}
+	default:
+		return func(a, b int64, strict bool) (int64, error) {
+			if b == 0 {
+				if strict {
+					return 0, ErrDivisionByZero
+				}
+				return 0, nil
+			}
+			return a % b, nil
+		}
+	}
+}
+
+func floatOperation(op string) func(a, b float64) float64 {
+	switch op {
+	case "+":
+		return func(a, b float64) float64 { return a + b }
+	case "-":
+		return func(a, b float64) float64 { return a - b }
+	case "*":
+		return func(a, b float64) float64 { return a * b }
+	case "/":
+		return func(a, b float64) float64 { return a / b }
+	default:
+		return math.Mod
+	}
+}
+
+// unordered is the comparison result when one of the operands is NaN. NaN is
+// unequal to everything, including NaN.
+const unordered = 2
+
+// comparator returns a function comparing two values of the given kinds. Bools
+// can only be checked for equality. Integers are promoted to floats when
+// compared with floats. The function returns -1, 0, 1 or unordered.
+func comparator(n *BinaryNode, left, right valueKind) (func(a, b value) int, error) {
+	switch {
+	case left == intKind && right == intKind:
+		return func(a, b value) int {
+			switch {
+			case a.i < b.i:
+				return -1
+			case a.i > b.i:
+				return 1
+			}
+			return 0
+		}, nil
+
+	case isNumeric(left) && isNumeric(right):
+		return func(a, b value) int {
+			af, bf := a.asFloat(), b.asFloat()
+			switch {
+			case af < bf:
+				return -1
+			case af > bf:
+				return 1
+			case af == bf:
+				return 0
+			}
+			return unordered
+		}, nil
+
+	case left == stringKind && right == stringKind:
+		return func(a, b value) int {
+			switch {
+			case a.s < b.s:
+				return -1
+			case a.s > b.s:
+				return 1
+			}
+			return 0
+		}, nil
+
+	case left == boolKind && right == boolKind && (n.Op == "==" || n.Op == "!="):
+		return func(a, b value) int {
+			if a.b == b.b {
+				return 0
+			}
+			return 1
+		}, nil
+	}
+	return nil, fmt.Errorf("can't compare %s and %s with %s at %s", left, right, n.Op, n.Pos)
+}
@@ -0,0 +1,355 @@
+package goplate
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestTokenizer(t *testing.T) {
+	assert := require.New(t)
+
+	tokens, err := tokenize(`a.b >= 1.5 && !(c == "x\"y") || d["key"]`)
+	assert.NoError(err)
+
+	var vals []string
+	for _, t := range tokens {
+		vals = append(vals, t.val)
+	}
+	assert.Equal([]string{"a", ".", "b", ">=", "1.5", "&&", "!", "(", "c", "==", `x"y`, ")", "||", "d", "[", "key", "]", ""}, vals)
+	assert.Equal(tokenFloat, tokens[4].typ)
+	assert.Equal(tokenString, tokens[10].typ)
+	assert.Equal(tokenEOF, tokens[len(tokens)-1].typ)
+
+	_, err = tokenize(`"unterminated`)
+	assert.Error(err)
+
+	_, err = tokenize(`a = b`)
+	assert.Error(err)
+
+	_, err = tokenize(`1.2.3`)
+	assert.Error(err)
+}
+
+func TestParseAction(t *testing.T) {
+	assert := require.New(t)
+
+	action, err := parseAction(`if a == 1 || b && !c`)
+	assert.NoError(err)
+	assert.Equal(actionIf, action.typ)
+
+	// && binds tighter than ||
+	or, ok := action.pipeline.Expr.(*BinaryNode)
+	assert.True(ok)
+	assert.Equal("||", or.Op)
+	and, ok := or.Right.(*BinaryNode)
+	assert.True(ok)
+	assert.Equal("&&", and.Op)
+
+	action, err = parseAction(`Some.Field["Key"] | json`)
+	assert.NoError(err)
+	assert.Equal(actionPipeline, action.typ)
+	assert.Len(action.pipeline.Transforms, 1)
+	assert.Equal("json", action.pipeline.Transforms[0].Name)
+	field, ok := action.pipeline.Expr.(*FieldNode)
+	assert.True(ok)
+	assert.Equal("some.field", field.Path)
+	assert.Equal("key", field.Key)
+
+	action, err = parseAction(`else`)
+	assert.NoError(err)
+	assert.Equal(actionElse, action.typ)
+
+	action, err = parseAction(`end`)
+	assert.NoError(err)
+	assert.Equal(actionEnd, action.typ)
+
+	for _, invalid := range []string{`end foo`, `a ==`, `(a == b`, `a < b < c`, `a | "json"`, `a.`, `a[b]`, ``} {
+		_, err = parseAction(invalid)
+		assert.Error(err, invalid)
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	assert := require.New(t)
+
+	params := &testStructure{
+		Int16:        16,
+		Int32:        32,
+		Int64Wrapper: &wrapperspb.Int64Value{Value: 64},
+		String:       "string",
+		Substructure: &testSubStructure{
+			Bool: true,
+			Map:  map[string]string{"name": "value"},
+			SubSub: &testSubSubStructure{
+				Float32: 1.5,
+			},
+		},
+	}
+
+	tests := map[string]string{
+		`{{ int32 == 32 }}`:                                     "true",
+		`{{ int32 != 32 }}`:                                     "false",
+		`{{ int16 < int32 }}`:                                   "true",
+		`{{ int64wrapper >= 64 }}`:                              "true",
+		`{{ substructure.subsub.float32 > 1 }}`:                 "true",
+		`{{ substructure.subsub.float32 <= 1.5 }}`:              "true",
+		`{{ string == "string" }}`:                              "true",
+		`{{ string < "strinh" }}`:                               "true",
+		`{{ substructure.map["name"] == "value" }}`:             "true",
+		`{{ !substructure.bool }}`:                              "false",
+		`{{ substructure.bool && (int16 > 20 || int32 > 20) }}`: "true",
+		`{{ boolwrapper == false }}`:                            "true",
+		`{{ "literal" }}`:                                       "literal",
+		`{{ 42 }}`:                                              "42",
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		buf := &bytes.Buffer{}
+		assert.NoError(tmpl.Execute(buf, params))
+		assert.Equal(expected, buf.String(), tmplStr)
+	}
+
+	// Nil pointers in the path evaluates to the zero value
+	tmpl, err := New(`{{ substructure.subsub.int == 0 }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	buf := &bytes.Buffer{}
+	assert.NoError(tmpl.Execute(buf, &testStructure{}))
+	assert.Equal("true", buf.String())
+}
+
+func TestExpressionTypeChecks(t *testing.T) {
+	assert := require.New(t)
+
+	for _, invalid := range []string{
+		`{{ int32 == "32" }}`,
+		`{{ substructure.bool < true }}`,
+		`{{ !int32 }}`,
+		`{{ int32 && substructure.bool }}`,
+		`{{ substructure == 1 }}`,
+		`{{ substructure.binary == 1 }}`,
+		`{{ substructure.unsupportedmap["name"] == "" }}`,
+		`{{ unknown == 1 }}`,
+		`{{ if int32 }}{{ end }}`,
+		`{{ if int32 == }}{{ end }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+}
+
+func TestConditionalSections(t *testing.T) {
+	assert := require.New(t)
+
+	tmpl, err := New(`{{ if int32 > 10 }}big{{ if substructure.bool }}/bool{{ end }}{{ else }}small{{ end }}:{{ int32 }}`).
+		WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(tmpl.Execute(buf, &testStructure{Int32: 11, Substructure: &testSubStructure{Bool: true}}))
+	assert.Equal("big/bool:11", buf.String())
+
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, &testStructure{Int32: 11}))
+	assert.Equal("big:11", buf.String())
+
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, &testStructure{Int32: 1}))
+	assert.Equal("small:1", buf.String())
+
+	for _, invalid := range []string{
+		`{{ if int32 > 1 }}`,
+		`{{ end }}`,
+		`{{ else }}`,
+		`{{ if int32 > 1 }}{{ else }}{{ else }}{{ end }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	assert := require.New(t)
+
+	params := &testStructure{
+		Int16:        -120,
+		Int32:        215,
+		Int64:        7,
+		Int32Wrapper: &wrapperspb.Int32Value{Value: 3},
+		Substructure: &testSubStructure{
+			SubSub: &testSubSubStructure{Float64: 2.5, Int: 2},
+		},
+	}
+
+	tests := map[string]string{
+		`{{ int16 + 120 }}`:                        "0",
+		`{{ int32 * 0.1 }}`:                        "21.5",
+		`{{ int32 / 10 }}`:                         "21",
+		`{{ int32 / 10.0 }}`:                       "21.5",
+		`{{ int32 % 10 }}`:                         "5",
+		`{{ int64 - int32wrapper * 2 }}`:           "1",
+		`{{ (int64 - int32wrapper) * 2 }}`:         "8",
+		`{{ -int64 + 1 }}`:                         "-6",
+		`{{ substructure.subsub.float64 * 2 }}`:    "5",
+		`{{ substructure.subsub.float64 % 1 }}`:    "0.5",
+		`{{ int32 / 0 }}`:                          "0",
+		`{{ int32 + 1 > 215 }}`:                    "true",
+		`{{ 10 - 2 - 3 }}`:                         "5",
+		`{{ substructure.subsub.int * 1.5 == 3 }}`: "true",
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		buf := &bytes.Buffer{}
+		assert.NoError(tmpl.Execute(buf, params), tmplStr)
+		assert.Equal(expected, buf.String(), tmplStr)
+	}
+
+	for _, invalid := range []string{
+		`{{ string + 1 }}`,
+		`{{ substructure.bool * 2 }}`,
+		`{{ -substructure.bool }}`,
+		`{{ !int32 }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+}
+
+func TestNaNComparisons(t *testing.T) {
+	assert := require.New(t)
+
+	// NaN is unequal to everything, including itself
+	params := &testStructure{Substructure: &testSubStructure{SubSub: &testSubSubStructure{Float64: math.NaN()}}}
+	tests := map[string]string{
+		`{{ substructure.subsub.float64 == substructure.subsub.float64 }}`: "false",
+		`{{ substructure.subsub.float64 != substructure.subsub.float64 }}`: "true",
+		`{{ substructure.subsub.float64 < 1 }}`:                            "false",
+		`{{ substructure.subsub.float64 > 1 }}`:                            "false",
+		`{{ substructure.subsub.float64 <= 1 }}`:                           "false",
+		`{{ 1 >= substructure.subsub.float64 }}`:                           "false",
+		`{{ 1.5 != substructure.subsub.float64 }}`:                         "true",
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(params)
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+}
+
+func TestStrictArithmetic(t *testing.T) {
+	assert := require.New(t)
+
+	params := &testStructure{Int64: math.MaxInt64, Int32: 0}
+
+	errs := map[string]error{
+		`{{ int64 + 1 }}`:                 ErrOverflow,
+		`{{ -int64 - 2 }}`:                ErrOverflow,
+		`{{ int64 * 2 }}`:                 ErrOverflow,
+		`{{ 1 / int32 }}`:                 ErrDivisionByZero,
+		`{{ 1 % int32 }}`:                 ErrDivisionByZero,
+		`{{ 1.5 / int32 }}`:               ErrDivisionByZero,
+		`{{ if 1 / int32 > 0 }}{{ end }}`: ErrDivisionByZero,
+	}
+	for tmplStr, expected := range errs {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).WithStrictMode().Build()
+		assert.NoError(err, tmplStr)
+		err = tmpl.Execute(io.Discard, params)
+		assert.ErrorIs(err, expected, tmplStr)
+
+		// Non-strict templates doesn't fail
+		tmpl, err = New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		assert.NoError(tmpl.Execute(io.Discard, params), tmplStr)
+	}
+
+	tmpl, err := New(`{{ substructure.subsub.float64 * 1000000 * 1000000 }}`).WithParameters(&testStructure{}).WithStrictMode().Build()
+	assert.NoError(err)
+	params.Substructure = &testSubStructure{SubSub: &testSubSubStructure{Float64: math.MaxFloat64}}
+	assert.ErrorIs(tmpl.Execute(io.Discard, params), ErrOverflow)
+}
+
+func TestVariables(t *testing.T) {
+	assert := require.New(t)
+
+	tmpl, err := New(`{{ $v := substructure.subsub }}{{ $v.float64 }}/{{ $v.Int }}/{{ $v.int * 2 }}/{{ $s := substructure }}{{ $s.map["name"] }}`).
+		WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+
+	params := &testStructure{
+		Substructure: &testSubStructure{
+			Map:    map[string]string{"name": "value"},
+			SubSub: &testSubSubStructure{Int: 2, Float64: 1.5},
+		},
+	}
+	buf := &bytes.Buffer{}
+	assert.NoError(tmpl.Execute(buf, params))
+	assert.Equal("1.5000000000/2/4/value", buf.String())
+
+	// Nil values in the path
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, &testStructure{}))
+	assert.Equal("0.0/0/0/", buf.String())
+
+	// Computed values and transforms
+	tmpl, err = New(`{{ $sum := int32 + int16 }}{{ $sum }}:{{ $big := $sum > 10 }}{{ if $big }}big{{ end }}:{{ $sub := substructure }}{{ $sub | json }}`).
+		WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	buf.Reset()
+	params = &testStructure{Int16: 5, Int32: 6, Substructure: &testSubStructure{Bool: true}}
+	assert.NoError(tmpl.Execute(buf, params))
+	expected, err := DefaultMarshaler().Marshal(params.Substructure)
+	assert.NoError(err)
+	assert.Equal("11:big:"+string(expected), buf.String())
+
+	// Variables are scoped to blocks
+	tmpl, err = New(`{{ $v := int32 }}{{ if int32 > 1 }}{{ $v := string }}{{ $v }}{{ else }}{{ $v }}{{ end }}/{{ $v }}`).
+		WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, &testStructure{Int32: 2, String: "str"}))
+	assert.Equal("str/2", buf.String())
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, &testStructure{Int32: 1, String: "str"}))
+	assert.Equal("1/1", buf.String())
+
+	for _, invalid := range []string{
+		`{{ $v }}`,
+		`{{ if int32 > 1 }}{{ $v := int32 }}{{ end }}{{ $v }}`,
+		`{{ if int32 > 1 }}{{ $v := int32 }}{{ else }}{{ $v }}{{ end }}`,
+		`{{ $v := substructure.subsub }}{{ $v.unknown }}`,
+		`{{ $v := substructure.subsub }}{{ $v.int == "x" }}`,
+		`{{ $v := int32 + 1 }}{{ $v.foo }}`,
+		`{{ $v := int32 }}{{ $v := int16 }}`,
+		`{{ $v := int32 | json }}`,
+		`{{ $ := int32 }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+}
+
+func BenchmarkExpression(b *testing.B) {
+	tmpl, err := New(`{{ if int32 > 10 && substructure.subsub.float64 < 1.5 }}yes{{ else }}no{{ end }}`).
+		WithParameters(&testStructure{}).Build()
+	if err != nil {
+		b.Fatal(err)
+	}
+	params := &testStructure{
+		Int32:        11,
+		Substructure: &testSubStructure{SubSub: &testSubSubStructure{Float64: 1.0}},
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tmpl.Execute(io.Discard, params); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
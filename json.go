@@ -1,14 +1,22 @@
 package goplate
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
 
+// DefaultMarshaler returns the marshaler for the json transform
 func DefaultMarshaler() JSONMarshaler {
 	return &defaultJSONMarshaler{}
 }
 
-type JSONMarshaler interface {
-	Marshal(obj interface{}) ([]byte, error)
-}
+// JSONMarshaler is the marshaler for the json transform
+type JSONMarshaler = Marshaler
 
 type defaultJSONMarshaler struct {
 }
@@ -16,3 +24,368 @@ type defaultJSONMarshaler struct {
 func (d *defaultJSONMarshaler) Marshal(obj interface{}) ([]byte, error) {
 	return json.Marshal(obj)
 }
+
+// jsonOptions are the arguments for the json transform
+type jsonOptions struct {
+	indent    string
+	omitEmpty bool
+	keyCase   func(string) string
+	sortKeys  bool
+	include   [][]string
+	exclude   [][]string
+}
+
+// jsonMember is a member of an object. Objects are kept as lists of members
+// to keep the order from the marshaler.
+type jsonMember struct {
+	key   string
+	value interface{}
+}
+
+type jsonObject []jsonMember
+
+// parseJSONOptions parses the arguments of the json transform. The
+// arguments are options with an optional value, ie "indent=4".
+func parseJSONOptions(args []interface{}) (*jsonOptions, error) {
+	opts := &jsonOptions{}
+	for i := range args {
+		arg, err := stringArg(args, i, "")
+		if err != nil {
+			return nil, err
+		}
+		name, value := arg, ""
+		if n := strings.Index(arg, "="); n >= 0 {
+			name, value = arg[:n], arg[n+1:]
+		}
+		switch name {
+		case "indent":
+			width := 2
+			if value != "" {
+				if width, err = strconv.Atoi(value); err != nil || width < 1 || width > 8 {
+					return nil, fmt.Errorf("indent must be 1 to 8 spaces")
+				}
+			}
+			opts.indent = strings.Repeat(" ", width)
+		case "omitEmpty":
+			opts.omitEmpty = true
+		case "snake":
+			opts.keyCase = snakeCase
+		case "camel":
+			opts.keyCase = camelCase
+		case "sortKeys":
+			opts.sortKeys = true
+		case "include", "exclude":
+			if value == "" {
+				return nil, fmt.Errorf("%s requires paths", name)
+			}
+			for _, path := range strings.Split(value, ",") {
+				keys := strings.Split(path, ".")
+				for i, key := range keys {
+					keys[i] = normalizeKey(key)
+				}
+				if name == "include" {
+					opts.include = append(opts.include, keys)
+				} else {
+					opts.exclude = append(opts.exclude, keys)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown json option %q", arg)
+		}
+		if value != "" && name != "indent" && name != "include" && name != "exclude" {
+			return nil, fmt.Errorf("json option %s doesn't take a value", name)
+		}
+	}
+	return opts, nil
+}
+
+// jsonTransform returns the factory for the json transform. Without
+// arguments the output from the marshaler is used as is. The options are
+// applied to the output from the marshaler so the field names and tags are
+// the ones the marshaler uses.
+func jsonTransform(m Marshaler) TransformFactory {
+	return func(args ...interface{}) (ValueTransformFunc, error) {
+		if len(args) == 0 {
+			return marshalerTransform(m)()
+		}
+		opts, err := parseJSONOptions(args)
+		if err != nil {
+			return nil, err
+		}
+		return func(v interface{}) (interface{}, error) {
+			buf, err := m.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return opts.format(buf)
+		}, nil
+	}
+}
+
+// format rewrites the JSON with the options
+func (o *jsonOptions) format(buf []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	v, err := readJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := writeJSON(&out, o.apply(v, nil)); err != nil {
+		return nil, err
+	}
+	if o.indent == "" {
+		return out.Bytes(), nil
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, out.Bytes(), "", o.indent); err != nil {
+		return nil, err
+	}
+	return indented.Bytes(), nil
+}
+
+// readJSON reads a value keeping the order of the object members
+func readJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := jsonObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := readJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonMember{key: key.(string), value: v})
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			v, err := readJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err = dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+// writeJSON writes the value without indentation
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	switch val := v.(type) {
+	case jsonObject:
+		buf.WriteByte('{')
+		for i, m := range val {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(m.key)
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, m.value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range val {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+// apply applies the options to the value at the path. Elements of arrays have
+// the same path as the array.
+func (o *jsonOptions) apply(v interface{}, path []string) interface{} {
+	switch val := v.(type) {
+	case jsonObject:
+		ret := jsonObject{}
+		for _, m := range val {
+			key := m.key
+			if o.keyCase != nil {
+				key = o.keyCase(key)
+			}
+			memberPath := append(path[:len(path):len(path)], normalizeKey(key))
+			inclusion := o.included(memberPath)
+			if inclusion == pathExcluded {
+				continue
+			}
+			value := o.apply(m.value, memberPath)
+			if (o.omitEmpty || inclusion == pathAncestor) && isEmptyJSON(value) {
+				continue
+			}
+			if inclusion == pathAncestor && !isContainerJSON(value) {
+				continue
+			}
+			ret = append(ret, jsonMember{key: key, value: value})
+		}
+		if o.sortKeys {
+			sort.SliceStable(ret, func(i, j int) bool { return ret[i].key < ret[j].key })
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(val))
+		for i, elem := range val {
+			ret[i] = o.apply(elem, path)
+		}
+		return ret
+	}
+	return v
+}
+
+// Path inclusion returned by included
+const (
+	pathExcluded = iota
+	pathIncluded
+	pathAncestor
+)
+
+// included checks the include and exclude paths. Members on an include path
+// or below one are included. Members above an include path are only kept if
+// they are arrays or objects with included members.
+func (o *jsonOptions) included(path []string) int {
+	for _, exclude := range o.exclude {
+		if hasPathPrefix(path, exclude) {
+			return pathExcluded
+		}
+	}
+	if len(o.include) == 0 {
+		return pathIncluded
+	}
+	ret := pathExcluded
+	for _, include := range o.include {
+		if hasPathPrefix(path, include) {
+			return pathIncluded
+		}
+		if hasPathPrefix(include, path) {
+			ret = pathAncestor
+		}
+	}
+	return ret
+}
+
+func hasPathPrefix(path []string, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isEmptyJSON checks if the value is null, false, 0, an empty string or an
+// empty array or object
+func isEmptyJSON(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !val
+	case string:
+		return val == ""
+	case json.Number:
+		f, err := val.Float64()
+		return err == nil && f == 0
+	case jsonObject:
+		return len(val) == 0
+	case []interface{}:
+		return len(val) == 0
+	}
+	return false
+}
+
+// isContainerJSON checks if the value is an array or object
+func isContainerJSON(v interface{}) bool {
+	switch v.(type) {
+	case jsonObject, []interface{}:
+		return true
+	}
+	return false
+}
+
+// normalizeKey returns the key used to match paths. Paths are matched
+// case insensitively and ignoring underscores and dashes so they match
+// regardless of the key casing.
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
+
+// keyWords splits a key into words at underscores, dashes, spaces and case
+// changes, ie "DeviceID" is "Device" and "ID" and "HTTPServer" is "HTTP" and
+// "Server".
+func keyWords(key string) []string {
+	var words []string
+	runes := []rune(key)
+	start := 0
+	for i := 0; i <= len(runes); i++ {
+		if i == len(runes) || runes[i] == '_' || runes[i] == '-' || runes[i] == ' ' {
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+			continue
+		}
+		if i == start || !unicode.IsUpper(runes[i]) {
+			continue
+		}
+		prev := runes[i-1]
+		if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+			(unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return words
+}
+
+// snakeCase converts a key to snake_case
+func snakeCase(key string) string {
+	words := keyWords(key)
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return strings.Join(words, "_")
+}
+
+// camelCase converts a key to camelCase
+func camelCase(key string) string {
+	words := keyWords(key)
+	for i, w := range words {
+		w = strings.ToLower(w)
+		if i > 0 {
+			r := []rune(w)
+			r[0] = unicode.ToUpper(r[0])
+			w = string(r)
+		}
+		words[i] = w
+	}
+	return strings.Join(words, "")
+}
@@ -0,0 +1,96 @@
+package goplate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONOptions(t *testing.T) {
+	assert := require.New(t)
+
+	type reading struct {
+		Value float64
+		Unit  string
+	}
+	type device struct {
+		DeviceID   string
+		HTTPServer string `json:"http_server"`
+		Tags       map[string]string
+		Readings   []reading
+		Location   *reading
+	}
+	value := &device{
+		DeviceID: "dev-1",
+		Tags:     map[string]string{"b": "2", "a": "1"},
+		Readings: []reading{{Value: 1.5, Unit: "C"}, {Value: 0}},
+	}
+
+	tests := map[string]string{
+		``:            `{"DeviceID":"dev-1","http_server":"","Tags":{"a":"1","b":"2"},"Readings":[{"Value":1.5,"Unit":"C"},{"Value":0,"Unit":""}],"Location":null}`,
+		`"omitEmpty"`: `{"DeviceID":"dev-1","Tags":{"a":"1","b":"2"},"Readings":[{"Value":1.5,"Unit":"C"},{}]}`,
+		`"snake" "omitEmpty"`: `{"device_id":"dev-1","tags":{"a":"1","b":"2"},` +
+			`"readings":[{"value":1.5,"unit":"C"},{}]}`,
+		`"camel" "sortKeys" "exclude=readings,tags"`: `{"deviceId":"dev-1","httpServer":"","location":null}`,
+		`"include=device_id,readings.value"`:         `{"DeviceID":"dev-1","Readings":[{"Value":1.5},{"Value":0}]}`,
+		`"include=location.value,tags.a"`:            `{"Tags":{"a":"1"}}`,
+		`"include=readings" "exclude=Readings.Unit"`: `{"Readings":[{"Value":1.5},{"Value":0}]}`,
+		`"indent" "include=tags"`:                    "{\n  \"Tags\": {\n    \"a\": \"1\",\n    \"b\": \"2\"\n  }\n}",
+		`"indent=4" "include=deviceID"`:              "{\n    \"DeviceID\": \"dev-1\"\n}",
+	}
+	set := transformSet{factories: TransformFactoryMap{"json": jsonTransform(DefaultMarshaler())}}
+	for args, expected := range tests {
+		n, err := parseAction(`x | json ` + args)
+		assert.NoError(err, args)
+		f, err := set.lookup(n.pipeline.Transforms[0])
+		assert.NoError(err, args)
+		s, err := f(nil, value)
+		assert.NoError(err, args)
+		assert.Equal(expected, string(s.([]byte)), args)
+	}
+
+	// The options are applied to the output from custom marshalers
+	tmpl, err := New(`{{ string | json "indent=1" }}`).
+		WithParameters(&testStructure{}).
+		WithJSONMarshaler(MarshalerFunc(func(obj interface{}) ([]byte, error) {
+			return []byte(`{"z":1,"a":[]}`), nil
+		})).
+		Build()
+	assert.NoError(err)
+	s, err := tmpl.ExecuteString(&testStructure{})
+	assert.NoError(err)
+	assert.Equal("{\n \"z\": 1,\n \"a\": []\n}", s)
+
+	for _, invalid := range []string{
+		`{{ string | json "pretty" }}`,
+		`{{ string | json "indent=0" }}`,
+		`{{ string | json "indent=x" }}`,
+		`{{ string | json "include" }}`,
+		`{{ string | json "snake=1" }}`,
+		`{{ string | json 2 }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+}
+
+func TestKeyCase(t *testing.T) {
+	assert := require.New(t)
+
+	tests := map[string][2]string{
+		"DeviceID":    {"device_id", "deviceId"},
+		"HTTPServer":  {"http_server", "httpServer"},
+		"device_id":   {"device_id", "deviceId"},
+		"deviceId":    {"device_id", "deviceId"},
+		"ID":          {"id", "id"},
+		"value2Unit":  {"value2_unit", "value2Unit"},
+		"kebab-case":  {"kebab_case", "kebabCase"},
+		"Ünits":       {"ünits", "ünits"},
+		"":            {"", ""},
+		"__private__": {"private", "private"},
+	}
+	for key, expected := range tests {
+		assert.Equal(expected[0], snakeCase(key), key)
+		assert.Equal(expected[1], camelCase(key), key)
+	}
+}
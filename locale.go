@@ -0,0 +1,256 @@
+package goplate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownLocale is returned when a locale isn't bundled or registered
+var ErrUnknownLocale = errors.New("unknown locale")
+
+// DefaultLocale is the locale used when no locale is set
+const DefaultLocale = "en-US"
+
+// Locale is the data for formatting numbers, currencies and dates. The date
+// formats are Go time layouts where the month and day names (January, Jan,
+// Monday and Mon) are replaced by the names for the locale.
+type Locale struct {
+	// Tag is the BCP 47 tag, ie "en-US"
+	Tag string
+	// Decimal is the decimal separator
+	Decimal string
+	// Group is the digit grouping separator
+	Group string
+	// MinGrouping is the minimum number of digits in the integer part
+	// before digits are grouped, ie 5 to write 1234 without grouping
+	MinGrouping int
+	// CurrencyFormat is the currency pattern where ¤ is the symbol and # is
+	// the number, ie "# ¤"
+	CurrencyFormat string
+	// CurrencySymbols overrides the default currency symbols
+	CurrencySymbols map[string]string
+	Months          [12]string
+	ShortMonths     [12]string
+	// Days and ShortDays start at Sunday
+	Days      [7]string
+	ShortDays [7]string
+	// DateFormats are the layouts for the short, medium, long and full date
+	// styles and the time and datetime styles
+	DateFormats map[string]string
+}
+
+var (
+	localeLock sync.RWMutex
+	locales    = make(map[string]*Locale)
+)
+
+// RegisterLocale adds or replaces a locale
+func RegisterLocale(l *Locale) {
+	localeLock.Lock()
+	defer localeLock.Unlock()
+	locales[strings.ToLower(l.Tag)] = l
+}
+
+// LookupLocale returns the locale for the tag. Tags are case insensitive and
+// tags with only a language, ie "de", or an unknown region, ie "de-CH", use
+// the bundled locale for the language.
+func LookupLocale(tag string) (*Locale, error) {
+	key := strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	localeLock.RLock()
+	defer localeLock.RUnlock()
+	if l, ok := locales[key]; ok {
+		return l, nil
+	}
+	lang := strings.SplitN(key, "-", 2)[0]
+	if l, ok := locales[languageLocales[lang]]; ok {
+		return l, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownLocale, tag)
+}
+
+// languageLocales are the locales used for tags with only a language
+var languageLocales = map[string]string{
+	"en": "en-us",
+	"de": "de-de",
+	"fr": "fr-fr",
+	"es": "es-es",
+	"it": "it-it",
+	"nl": "nl-nl",
+	"nb": "nb-no",
+	"no": "nb-no",
+	"sv": "sv-se",
+	"da": "da-dk",
+	"pt": "pt-br",
+	"ja": "ja-jp",
+}
+
+// currencySymbols are the default currency symbols. Currencies without a
+// symbol use the currency code.
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"CNY": "CN¥",
+	"INR": "₹",
+	"BRL": "R$",
+	"CAD": "CA$",
+	"AUD": "A$",
+	"NOK": "kr",
+	"SEK": "kr",
+	"DKK": "kr.",
+	"PLN": "zł",
+}
+
+// currencyDecimals are the currencies without 2 decimals
+var currencyDecimals = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"ISK": 0,
+	"CLP": 0,
+	"VND": 0,
+}
+
+var englishMonths = [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+var englishShortMonths = [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+var englishDays = [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+var englishShortDays = [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+func init() {
+	for _, l := range bundledLocales {
+		RegisterLocale(l)
+	}
+}
+
+var bundledLocales = []*Locale{
+	{
+		Tag: "en-US", Decimal: ".", Group: ",", MinGrouping: 1, CurrencyFormat: "¤#",
+		Months: englishMonths, ShortMonths: englishShortMonths, Days: englishDays, ShortDays: englishShortDays,
+		DateFormats: map[string]string{
+			"short": "1/2/06", "medium": "Jan 2, 2006", "long": "January 2, 2006",
+			"full": "Monday, January 2, 2006", "time": "3:04 PM", "datetime": "Jan 2, 2006, 3:04 PM",
+		},
+	},
+	{
+		Tag: "en-GB", Decimal: ".", Group: ",", MinGrouping: 1, CurrencyFormat: "¤#",
+		CurrencySymbols: map[string]string{"USD": "US$"},
+		Months:          englishMonths, ShortMonths: englishShortMonths, Days: englishDays, ShortDays: englishShortDays,
+		DateFormats: map[string]string{
+			"short": "02/01/2006", "medium": "2 Jan 2006", "long": "2 January 2006",
+			"full": "Monday 2 January 2006", "time": "15:04", "datetime": "2 Jan 2006, 15:04",
+		},
+	},
+	{
+		Tag: "de-DE", Decimal: ",", Group: ".", MinGrouping: 1, CurrencyFormat: "#\u00a0¤",
+		Months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		ShortMonths: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		Days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		ShortDays:   [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+		DateFormats: map[string]string{
+			"short": "02.01.06", "medium": "02.01.2006", "long": "2. January 2006",
+			"full": "Monday, 2. January 2006", "time": "15:04", "datetime": "02.01.2006, 15:04",
+		},
+	},
+	{
+		Tag: "fr-FR", Decimal: ",", Group: "\u202f", MinGrouping: 1, CurrencyFormat: "#\u00a0¤",
+		Months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		ShortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		Days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		ShortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		DateFormats: map[string]string{
+			"short": "02/01/2006", "medium": "2 Jan 2006", "long": "2 January 2006",
+			"full": "Monday 2 January 2006", "time": "15:04", "datetime": "2 Jan 2006, 15:04",
+		},
+	},
+	{
+		Tag: "es-ES", Decimal: ",", Group: ".", MinGrouping: 2, CurrencyFormat: "#\u00a0¤",
+		Months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		ShortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		Days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		ShortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		DateFormats: map[string]string{
+			"short": "2/1/06", "medium": "2 Jan 2006", "long": "2 de January de 2006",
+			"full": "Monday, 2 de January de 2006", "time": "15:04", "datetime": "2 Jan 2006, 15:04",
+		},
+	},
+	{
+		Tag: "it-IT", Decimal: ",", Group: ".", MinGrouping: 1, CurrencyFormat: "#\u00a0¤",
+		Months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		ShortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		Days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		ShortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+		DateFormats: map[string]string{
+			"short": "02/01/06", "medium": "2 Jan 2006", "long": "2 January 2006",
+			"full": "Monday 2 January 2006", "time": "15:04", "datetime": "2 Jan 2006, 15:04",
+		},
+	},
+	{
+		Tag: "nl-NL", Decimal: ",", Group: ".", MinGrouping: 1, CurrencyFormat: "¤\u00a0#",
+		Months:      [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		ShortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		Days:        [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		ShortDays:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+		DateFormats: map[string]string{
+			"short": "02-01-2006", "medium": "2 Jan 2006", "long": "2 January 2006",
+			"full": "Monday 2 January 2006", "time": "15:04", "datetime": "2 Jan 2006 15:04",
+		},
+	},
+	{
+		Tag: "nb-NO", Decimal: ",", Group: "\u00a0", MinGrouping: 1, CurrencyFormat: "#\u00a0¤",
+		Months:      [12]string{"januar", "februar", "mars", "april", "mai", "juni", "juli", "august", "september", "oktober", "november", "desember"},
+		ShortMonths: [12]string{"jan.", "feb.", "mar.", "apr.", "mai", "jun.", "jul.", "aug.", "sep.", "okt.", "nov.", "des."},
+		Days:        [7]string{"søndag", "mandag", "tirsdag", "onsdag", "torsdag", "fredag", "lørdag"},
+		ShortDays:   [7]string{"søn.", "man.", "tir.", "ons.", "tor.", "fre.", "lør."},
+		DateFormats: map[string]string{
+			"short": "02.01.2006", "medium": "2. Jan 2006", "long": "2. January 2006",
+			"full": "Monday 2. January 2006", "time": "15:04", "datetime": "2. Jan 2006, 15:04",
+		},
+	},
+	{
+		Tag: "sv-SE", Decimal: ",", Group: "\u00a0", MinGrouping: 1, CurrencyFormat: "#\u00a0¤",
+		Months:      [12]string{"januari", "februari", "mars", "april", "maj", "juni", "juli", "augusti", "september", "oktober", "november", "december"},
+		ShortMonths: [12]string{"jan.", "feb.", "mars", "apr.", "maj", "juni", "juli", "aug.", "sep.", "okt.", "nov.", "dec."},
+		Days:        [7]string{"söndag", "måndag", "tisdag", "onsdag", "torsdag", "fredag", "lördag"},
+		ShortDays:   [7]string{"sön", "mån", "tis", "ons", "tors", "fre", "lör"},
+		DateFormats: map[string]string{
+			"short": "2006-01-02", "medium": "2 Jan 2006", "long": "2 January 2006",
+			"full": "Monday 2 January 2006", "time": "15:04", "datetime": "2 Jan 2006 15:04",
+		},
+	},
+	{
+		Tag: "da-DK", Decimal: ",", Group: ".", MinGrouping: 1, CurrencyFormat: "#\u00a0¤",
+		Months:      [12]string{"januar", "februar", "marts", "april", "maj", "juni", "juli", "august", "september", "oktober", "november", "december"},
+		ShortMonths: [12]string{"jan.", "feb.", "mar.", "apr.", "maj", "jun.", "jul.", "aug.", "sep.", "okt.", "nov.", "dec."},
+		Days:        [7]string{"søndag", "mandag", "tirsdag", "onsdag", "torsdag", "fredag", "lørdag"},
+		ShortDays:   [7]string{"søn.", "man.", "tirs.", "ons.", "tors.", "fre.", "lør."},
+		DateFormats: map[string]string{
+			"short": "02.01.2006", "medium": "2. Jan 2006", "long": "2. January 2006",
+			"full": "Monday den 2. January 2006", "time": "15.04", "datetime": "2. Jan 2006 15.04",
+		},
+	},
+	{
+		Tag: "pt-BR", Decimal: ",", Group: ".", MinGrouping: 1, CurrencyFormat: "¤\u00a0#",
+		Months:      [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		ShortMonths: [12]string{"jan.", "fev.", "mar.", "abr.", "mai.", "jun.", "jul.", "ago.", "set.", "out.", "nov.", "dez."},
+		Days:        [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		ShortDays:   [7]string{"dom.", "seg.", "ter.", "qua.", "qui.", "sex.", "sáb."},
+		DateFormats: map[string]string{
+			"short": "02/01/2006", "medium": "2 de Jan de 2006", "long": "2 de January de 2006",
+			"full": "Monday, 2 de January de 2006", "time": "15:04", "datetime": "2 de Jan de 2006 15:04",
+		},
+	},
+	{
+		Tag: "ja-JP", Decimal: ".", Group: ",", MinGrouping: 1, CurrencyFormat: "¤#",
+		CurrencySymbols: map[string]string{"JPY": "￥", "CNY": "元"},
+		Months:          [12]string{"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+		ShortMonths:     [12]string{"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+		Days:            [7]string{"日曜日", "月曜日", "火曜日", "水曜日", "木曜日", "金曜日", "土曜日"},
+		ShortDays:       [7]string{"日", "月", "火", "水", "木", "金", "土"},
+		DateFormats: map[string]string{
+			"short": "2006/01/02", "medium": "2006/01/02", "long": "2006年1月2日",
+			"full": "2006年1月2日Monday", "time": "15:04", "datetime": "2006/01/02 15:04",
+		},
+	},
+}
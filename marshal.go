@@ -0,0 +1,138 @@
+package goplate
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Marshaler encodes values for the serializer transforms
+type Marshaler interface {
+	Marshal(obj interface{}) ([]byte, error)
+}
+
+// MarshalerFunc is a function implementing Marshaler
+type MarshalerFunc func(obj interface{}) ([]byte, error)
+
+// Marshal calls the function
+func (f MarshalerFunc) Marshal(obj interface{}) ([]byte, error) {
+	return f(obj)
+}
+
+// MarshalerMap is the registry of serializers. Each marshaler is available as
+// a transform with the same name.
+type MarshalerMap map[string]Marshaler
+
+// DefaultMarshalers returns the serializers registered by default by New:
+// json, yaml, xml, cbor, msgpack and csv.
+//
+// cbor and msgpack encode structures as maps keyed by the field names like
+// json does. csv writes one record for lists of lists, maps or structures and
+// a single record for other values. The fields of maps are sorted by key.
+func DefaultMarshalers() MarshalerMap {
+	return MarshalerMap{
+		"json":    DefaultMarshaler(),
+		"yaml":    MarshalerFunc(marshalYAML),
+		"xml":     MarshalerFunc(marshalXML),
+		"cbor":    MarshalerFunc(marshalCBOR),
+		"msgpack": MarshalerFunc(marshalMsgpack),
+		"csv":     MarshalerFunc(marshalCSV),
+	}
+}
+
+// marshalerTransform returns a factory for the serializer transform. Errors
+// from the marshaler stop the execution.
+func marshalerTransform(m Marshaler) TransformFactory {
+	return func(args ...interface{}) (ValueTransformFunc, error) {
+		if err := checkArgs(args, 0, 0); err != nil {
+			return nil, err
+		}
+		return func(v interface{}) (interface{}, error) {
+			return m.Marshal(v)
+		}, nil
+	}
+}
+
+func marshalYAML(obj interface{}) ([]byte, error) {
+	return yaml.Marshal(plainValue(obj))
+}
+
+func marshalXML(obj interface{}) ([]byte, error) {
+	return xml.Marshal(plainValue(obj))
+}
+
+// isRecord checks if the value is written as a record with several fields
+func isRecord(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		return rv.Type().Elem().Kind() != reflect.Uint8
+	case reflect.Map, reflect.Struct:
+		return true
+	}
+	return false
+}
+
+// indirectValue follows pointers and interfaces
+func indirectValue(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+// csvRecord returns the fields of a value
+func csvRecord(rv reflect.Value) []string {
+	var fields []reflect.Value
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			fields = append(fields, rv.Index(i))
+		}
+	case reflect.Map:
+		for _, key := range sortedKeys(rv) {
+			fields = append(fields, rv.MapIndex(key))
+		}
+	case reflect.Struct:
+		for _, f := range structFields(rv) {
+			fields = append(fields, f.value)
+		}
+	default:
+		fields = []reflect.Value{rv}
+	}
+	ret := make([]string, len(fields))
+	for i, f := range fields {
+		if f.IsValid() && f.CanInterface() {
+			ret[i] = formatValue(f.Interface())
+		}
+	}
+	return ret
+}
+
+func marshalCSV(obj interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(plainValue(obj))
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil, nil
+	}
+	rv = indirectValue(rv)
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	var records [][]string
+	if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && isRecord(rv) &&
+		rv.Len() > 0 && isRecord(indirectValue(rv.Index(0))) {
+		for i := 0; i < rv.Len(); i++ {
+			records = append(records, csvRecord(indirectValue(rv.Index(i))))
+		}
+	} else {
+		records = [][]string{csvRecord(rv)}
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,186 @@
+package goplate
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMarshalers(t *testing.T) {
+	assert := require.New(t)
+
+	params := &testStructure{
+		String:       "a<b",
+		ArrayOfint32: []int32{1, 2, 3},
+		Substructure: &testSubStructure{
+			String: wrapperspb.String("sub"),
+			Map:    map[string]string{"name": "x", "id": "1"},
+			Binary: []byte{1},
+		},
+	}
+	tests := map[string]string{
+		`{{ arrayofint32 | csv }}`:                                      "1,2,3\n",
+		`{{ substructure.map | csv }}`:                                  "1,x\n",
+		`{{ substructure.map | yaml }}`:                                 "id: \"1\"\nname: x\n",
+		`{{ string | xml }}`:                                            "<string>a&lt;b</string>",
+		`{{ substructure.map | json }}`:                                 `{"id":"1","name":"x"}`,
+		`{{ substructure.map | cbor | cborDecode | get "name" }}`:       "x",
+		`{{ substructure | msgpack | msgpackDecode | get "String" }}`:   "sub",
+		`{{ arrayofint32 | msgpack | hex }}`:                            "93010203",
+		`{{ substructure.string | cbor | hex }}`:                        "63737562",
+		`{{ substructure | cbor | cborDecode | get "Map.id" | upper }}`: "1",
+		// Byte slices are encoded like other values
+		`{{ substructure.binary | cbor | hex }}`:              `4101`,
+		`{{ substructure.binary | msgpack | hex }}`:           `c40101`,
+		`{{ substructure.binary | cbor | cborDecode | hex }}`: `01`,
+		`{{ substructure.binary | msgpack | msgpack | hex }}`: `c403c40101`,
+		`{{ string | json | cbor | cborDecode }}`:             `"a\u003cb"`,
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(params)
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+
+	// Custom marshalers replace the default ones and errors stop the execution
+	tmpl, err := New(`{{ string | json }} {{ string | env }}`).
+		WithParameters(&testStructure{}).
+		WithMarshalers(MarshalerMap{
+			"json": MarshalerFunc(func(obj interface{}) ([]byte, error) { return []byte("custom"), nil }),
+			"env": MarshalerFunc(func(obj interface{}) ([]byte, error) {
+				return []byte("VALUE=" + formatValue(obj)), nil
+			}),
+		}).
+		Build()
+	assert.NoError(err)
+	s, err := tmpl.ExecuteString(params)
+	assert.NoError(err)
+	assert.Equal("custom VALUE=a<b", s)
+
+	tmpl, err = New(`a{{ string | fail }}`).
+		WithParameters(&testStructure{}).
+		WithMarshalers(MarshalerMap{
+			"fail": MarshalerFunc(func(obj interface{}) ([]byte, error) { return nil, errors.New("fail") }),
+		}).
+		Build()
+	assert.NoError(err)
+	_, err = tmpl.ExecuteString(params)
+	assert.Error(err)
+
+	// Without arguments json renders marshal errors as before
+	tmpl, err = New(`{{ string | json }}`).
+		WithParameters(&testStructure{}).
+		WithJSONMarshaler(MarshalerFunc(func(obj interface{}) ([]byte, error) { return nil, errors.New("fail") })).
+		Build()
+	assert.NoError(err)
+	s, err = tmpl.ExecuteString(params)
+	assert.NoError(err)
+	assert.Equal("error", s)
+
+	tmpl, err = New(`{{ string | json "indent" }}`).
+		WithParameters(&testStructure{}).
+		WithJSONMarshaler(MarshalerFunc(func(obj interface{}) ([]byte, error) { return nil, errors.New("fail") })).
+		Build()
+	assert.NoError(err)
+	_, err = tmpl.ExecuteString(params)
+	assert.Error(err)
+
+	_, err = New(`{{ string | yaml 1 }}`).WithParameters(&testStructure{}).Build()
+	assert.Error(err)
+}
+
+func TestBinaryMarshalers(t *testing.T) {
+	assert := require.New(t)
+
+	type reading struct {
+		Value   float64 `json:"value"`
+		Unit    string  `json:"unit,omitempty"`
+		Skipped bool    `json:"-"`
+	}
+	tests := []struct {
+		value   interface{}
+		cbor    string
+		msgpack string
+	}{
+		{nil, "f6", "c0"},
+		{true, "f5", "c3"},
+		{uint8(10), "0a", "0a"},
+		{500, "1901f4", "cd01f4"},
+		{-1, "20", "ff"},
+		{-500, "3901f3", "d1fe0c"},
+		{int64(-1 << 40), "3b000000ffffffffff", "d3ffffff0000000000"},
+		{1.5, "fa3fc00000", "ca3fc00000"},
+		{0.1, "fb3fb999999999999a", "cb3fb999999999999a"},
+		{"a", "6161", "a161"},
+		{strings.Repeat("a", 40), "7828" + strings.Repeat("61", 40), "d928" + strings.Repeat("61", 40)},
+		{[]byte{1, 2}, "420102", "c4020102"},
+		{[]string{"a"}, "816161", "91a161"},
+		{map[string]int{"b": 2, "a": 1}, "a2616101616202", "82a161" + "01a16202"},
+		{reading{Value: 1, Unit: "C", Skipped: true}, "a26576616c7565fa3f80000064756e69746143",
+			"82a576616c7565ca3f800000a4756e6974a143"},
+		{wrapperspb.Int32(7), "07", "07"},
+	}
+	for _, test := range tests {
+		b, err := marshalCBOR(test.value)
+		assert.NoError(err)
+		assert.Equal(test.cbor, hex.EncodeToString(b), "%v", test.value)
+		b, err = marshalMsgpack(test.value)
+		assert.NoError(err)
+		assert.Equal(test.msgpack, hex.EncodeToString(b), "%v", test.value)
+	}
+
+	// Large values round trip through the decoders
+	large := make([]interface{}, 70000)
+	for i := range large {
+		large[i] = uint64(i)
+	}
+	for _, v := range []interface{}{large, map[string]interface{}{strings.Repeat("k", 300): "v"}} {
+		b, err := marshalCBOR(v)
+		assert.NoError(err)
+		decoded, err := decodeCBOR(b)
+		assert.NoError(err)
+		assert.Equal(v, decoded)
+		b, err = marshalMsgpack(v)
+		assert.NoError(err)
+		decoded, err = decodeMsgpack(b)
+		assert.NoError(err)
+		assert.Equal(v, decoded)
+	}
+
+	_, err := marshalCBOR(func() {})
+	assert.Error(err)
+	_, err = marshalMsgpack(make(chan int))
+	assert.Error(err)
+}
+
+func TestCSVMarshaler(t *testing.T) {
+	assert := require.New(t)
+
+	type row struct {
+		ID   int
+		Name string
+	}
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, ""},
+		{"a,b", "\"a,b\"\n"},
+		{[]interface{}{1, "x"}, "1,x\n"},
+		{[][]interface{}{{1, "a,b"}, {2, "c"}}, "1,\"a,b\"\n2,c\n"},
+		{[]row{{1, "a"}, {2, "b"}}, "1,a\n2,b\n"},
+		{&row{3, "c"}, "3,c\n"},
+		{[]map[string]int{{"b": 2, "a": 1}}, "1,2\n"},
+	}
+	for _, test := range tests {
+		b, err := marshalCSV(test.value)
+		assert.NoError(err)
+		assert.Equal(test.expected, string(b), "%v", test.value)
+	}
+}
@@ -0,0 +1,271 @@
+package goplate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// ErrNotMatchable is returned when matching with a template that has anything
+// but static text and plain fields
+var ErrNotMatchable = errors.New("template can't be matched")
+
+// ErrNoMatch is returned when the string doesn't match the template
+var ErrNoMatch = errors.New("string doesn't match template")
+
+// ErrAmbiguousMatch is returned when the string matches the template with
+// different field values
+var ErrAmbiguousMatch = errors.New("ambiguous match")
+
+// matchSegment is static text or a field in a template used for matching
+type matchSegment struct {
+	text  string
+	info  *lookupInfo
+	parse func(string) (reflect.Value, error)
+}
+
+// matcher parses rendered strings back into field values. The segments
+// alternate between text and fields, two fields are never next to each other.
+type matcher struct {
+	segments []matchSegment
+}
+
+// newMatcher creates a matcher for the template. Only static text, comments
+// and plain fields without transforms are supported.
+func newMatcher(tree *ListNode, digger *structDigger) (*matcher, error) {
+	m := &matcher{}
+	var prev Node
+	for _, node := range tree.Nodes {
+		switch n := node.(type) {
+		case *TextNode:
+			if last := len(m.segments) - 1; last >= 0 && m.segments[last].info == nil {
+				m.segments[last].text += n.Text
+				break
+			}
+			m.segments = append(m.segments, matchSegment{text: n.Text})
+
+		case *CommentNode:
+
+		case *ActionNode:
+			field, ok := n.Pipe.Expr.(*FieldNode)
+			if !ok || field.Variable != "" || field.HasKey || len(n.Pipe.Transforms) > 0 {
+				return nil, fmt.Errorf("%w: %s at %s isn't a plain field", ErrNotMatchable, n.Pipe, n.Pos)
+			}
+			info := digger.findField(field.Path)
+			if info == nil {
+				return nil, fmt.Errorf("%w: %s at %s is not a known expression", ErrNotMatchable, field, n.Pos)
+			}
+			parse := fieldParser(info)
+			if parse == nil {
+				return nil, fmt.Errorf("%w: %s (%s) can't be parsed", ErrNotMatchable, field, info.Type)
+			}
+			if last := len(m.segments) - 1; last >= 0 && m.segments[last].info != nil {
+				return nil, fmt.Errorf("%w: fields at %s and %s aren't separated", ErrNotMatchable, prev.Position(), n.Pos)
+			}
+			m.segments = append(m.segments, matchSegment{info: info, parse: parse})
+			prev = n
+
+		default:
+			return nil, fmt.Errorf("%w: unsupported tag at %s", ErrNotMatchable, node.Position())
+		}
+	}
+	return m, nil
+}
+
+// fieldParser returns a function parsing field values of the field's type.
+// It returns nil if the type isn't supported.
+func fieldParser(info *lookupInfo) func(string) (reflect.Value, error) {
+	if !info.IsLeaf || info.IsMap {
+		return nil
+	}
+	t := info.Type
+	switch t {
+	case reflect.TypeOf(&wrapperspb.StringValue{}):
+		return func(s string) (reflect.Value, error) {
+			return reflect.ValueOf(wrapperspb.String(s)), nil
+		}
+	case reflect.TypeOf(&wrapperspb.Int32Value{}):
+		return func(s string) (reflect.Value, error) {
+			v, err := strconv.ParseInt(s, 10, 32)
+			return reflect.ValueOf(wrapperspb.Int32(int32(v))), err
+		}
+	case reflect.TypeOf(&wrapperspb.Int64Value{}):
+		return func(s string) (reflect.Value, error) {
+			v, err := strconv.ParseInt(s, 10, 64)
+			return reflect.ValueOf(wrapperspb.Int64(v)), err
+		}
+	case reflect.TypeOf(&wrapperspb.BoolValue{}):
+		return func(s string) (reflect.Value, error) {
+			v, err := strconv.ParseBool(s)
+			return reflect.ValueOf(wrapperspb.Bool(v)), err
+		}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return func(s string) (reflect.Value, error) {
+			return reflect.ValueOf(s).Convert(t), nil
+		}
+	case reflect.Bool:
+		return func(s string) (reflect.Value, error) {
+			v, err := strconv.ParseBool(s)
+			return reflect.ValueOf(v).Convert(t), err
+		}
+	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(s string) (reflect.Value, error) {
+			v, err := strconv.ParseInt(s, 10, t.Bits())
+			return reflect.ValueOf(v).Convert(t), err
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(s string) (reflect.Value, error) {
+			v, err := strconv.ParseFloat(s, t.Bits())
+			return reflect.ValueOf(v).Convert(t), err
+		}
+	}
+	return nil
+}
+
+// matchResult is a set of field values found when matching
+type matchResult struct {
+	values map[string]reflect.Value
+	text   map[string]string
+}
+
+// match finds the field values in the string. The search stops when a second
+// match with different values is found.
+func (m *matcher) match(s string) (*matchResult, error) {
+	var results []*matchResult
+	current := &matchResult{values: make(map[string]reflect.Value), text: make(map[string]string)}
+	m.search(s, 0, 0, current, &results)
+	switch len(results) {
+	case 0:
+		return nil, ErrNoMatch
+	case 1:
+		return results[0], nil
+	}
+	return nil, ErrAmbiguousMatch
+}
+
+// search matches the segments from k at position i in the string. Fields
+// can match any text that parses as the field's type up to the next
+// occurrence of the following static text. A field used more than once must
+// have the same value every time.
+func (m *matcher) search(s string, k int, i int, current *matchResult, results *[]*matchResult) {
+	if len(*results) > 1 {
+		return
+	}
+	if k == len(m.segments) {
+		if i == len(s) {
+			addResult(current, results)
+		}
+		return
+	}
+	seg := m.segments[k]
+	if seg.info == nil {
+		if strings.HasPrefix(s[i:], seg.text) {
+			m.search(s, k+1, i+len(seg.text), current, results)
+		}
+		return
+	}
+
+	path := seg.info.FieldName
+	for j := i; j <= len(s); j++ {
+		if k+1 < len(m.segments) && !strings.HasPrefix(s[j:], m.segments[k+1].text) {
+			continue
+		}
+		if k+1 == len(m.segments) && j < len(s) {
+			continue
+		}
+		text := s[i:j]
+		if prev, exists := current.text[path]; exists {
+			if prev == text {
+				m.search(s, k+1, j, current, results)
+			}
+			continue
+		}
+		v, err := seg.parse(text)
+		if err != nil {
+			continue
+		}
+		current.text[path] = text
+		current.values[path] = v
+		m.search(s, k+1, j, current, results)
+		delete(current.text, path)
+		delete(current.values, path)
+	}
+}
+
+// addResult adds a copy of the result unless the same values have been found
+// already
+func addResult(current *matchResult, results *[]*matchResult) {
+	for _, r := range *results {
+		if reflect.DeepEqual(r.text, current.text) {
+			return
+		}
+	}
+	ret := &matchResult{values: make(map[string]reflect.Value), text: make(map[string]string)}
+	for k, v := range current.text {
+		ret.text[k] = v
+		ret.values[k] = current.values[k]
+	}
+	*results = append(*results, ret)
+}
+
+// setFieldValue sets the field in the parameters, allocating nil structures
+// along the way.
+func setFieldValue(params reflect.Value, info *lookupInfo, v reflect.Value) {
+	field := params
+	for _, index := range info.FieldIndex {
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			field = field.Elem()
+		}
+		field = field.Field(index)
+	}
+	field.Set(v)
+}
+
+// Extract parses a string rendered by the template and returns the values of
+// the fields keyed by the lower case field path. The template can only
+// contain static text and plain fields. ErrNoMatch is returned if the string
+// doesn't match and ErrAmbiguousMatch if there is more than one set of field
+// values that renders the string.
+func (t *Template) Extract(s string) (map[string]string, error) {
+	if t.matchErr != nil {
+		return nil, t.matchErr
+	}
+	result, err := t.matcher.match(s)
+	if err != nil {
+		return nil, err
+	}
+	return result.text, nil
+}
+
+// Match parses a string rendered by the template and sets the fields in the
+// parameters. The parameters must be a pointer to the same type as the
+// template is built with. Fields not in the template are left as is. See
+// Extract for the errors returned.
+func (t *Template) Match(s string, params interface{}) error {
+	if t.matchErr != nil {
+		return t.matchErr
+	}
+	if t.paramType.Kind() != reflect.Ptr || reflect.TypeOf(params) != t.paramType || reflect.ValueOf(params).IsNil() {
+		return fmt.Errorf("parameters must be a non-nil %s", t.paramType)
+	}
+	result, err := t.matcher.match(s)
+	if err != nil {
+		return err
+	}
+	root := reflect.ValueOf(params).Elem()
+	for _, seg := range t.matcher.segments {
+		if seg.info != nil {
+			setFieldValue(root, seg.info, result.values[seg.info.FieldName])
+		}
+	}
+	return nil
+}
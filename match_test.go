@@ -0,0 +1,87 @@
+package goplate
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMatch(t *testing.T) {
+	assert := require.New(t)
+
+	tmpl, err := New(`devices/{{ substructure.string }}/{{ int32 }}/{{ string }}/up`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+
+	values, err := tmpl.Extract("devices/dev-1/42/a/b/up")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"substructure.string": "dev-1", "int32": "42", "string": "a/b"}, values)
+
+	params := &testStructure{Int64: 7}
+	assert.NoError(tmpl.Match("devices/dev-1/42/x/up", params))
+	assert.Equal("dev-1", params.Substructure.String.Value)
+	assert.Equal(int32(42), params.Int32)
+	assert.Equal("x", params.String)
+	assert.Equal(int64(7), params.Int64)
+
+	// Rendering the parameters gives the same string
+	buf := &bytes.Buffer{}
+	assert.NoError(tmpl.Execute(buf, params))
+	assert.Equal("devices/dev-1/42/x/up", buf.String())
+
+	_, err = tmpl.Extract("devices/dev-1/not-a-number/x/up")
+	assert.True(errors.Is(err, ErrNoMatch))
+	_, err = tmpl.Extract("other/dev-1/42/x/up")
+	assert.True(errors.Is(err, ErrNoMatch))
+
+	assert.Error(tmpl.Match("devices/dev-1/42/x/up", testStructure{}))
+	assert.Error(tmpl.Match("devices/dev-1/42/x/up", (*testStructure)(nil)))
+}
+
+func TestMatchAmbiguity(t *testing.T) {
+	assert := require.New(t)
+
+	tmpl, err := New(`{{ string }}-{{ substructure.string }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	_, err = tmpl.Extract("a-b-c")
+	assert.True(errors.Is(err, ErrAmbiguousMatch))
+
+	values, err := tmpl.Extract("a-b")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"string": "a", "substructure.string": "b"}, values)
+
+	// Types and repeated fields resolve what would otherwise be ambiguous
+	tmpl, err = New(`{{ string }}-{{ int32 }}/{{ string }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	values, err = tmpl.Extract("a-b-1/a-b")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"string": "a-b", "int32": "1"}, values)
+
+	params := &testStructure{}
+	tmpl, err = New(`{{ int32wrapper }}.{{ boolwrapper }}.{{ substructure.subsub.float64 }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	assert.NoError(tmpl.Match("3.true.1.5", params))
+	assert.Equal(&wrapperspb.Int32Value{Value: 3}, params.Int32Wrapper)
+	assert.Equal(&wrapperspb.BoolValue{Value: true}, params.BoolWrapper)
+	assert.Equal(1.5, params.Substructure.SubSub.Float64)
+}
+
+func TestMatchUnsupported(t *testing.T) {
+	assert := require.New(t)
+
+	for _, tmplStr := range []string{
+		`{{ int32 }}{{ string }}`,
+		`{{ int32 + 1 }}`,
+		`{{ substructure.binary | hex }}`,
+		`{{ substructure.map["name"] }}`,
+		`{{ if int32 > 1 }}x{{ end }}`,
+		`{{ substructure.binary }}`,
+	} {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		_, err = tmpl.Extract("1")
+		assert.True(errors.Is(err, ErrNotMatchable), tmplStr)
+	}
+}
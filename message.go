@@ -0,0 +1,422 @@
+package goplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// message is a parsed catalog message. Messages from gettext files with
+// plural forms have one message for each form.
+type message struct {
+	parts []messagePart
+	// forms are the plural forms selected by the first argument
+	forms  []*message
+	plural *pluralForms
+}
+
+// messagePart is static text or an argument. The argument is -1 for text.
+// Arguments are formatted by their type, which is empty for plain
+// arguments, number, date, plural or select. Plural and select arguments
+// pick one of the cases.
+type messagePart struct {
+	text  string
+	arg   int
+	typ   string
+	style string
+	cases map[string]*message
+	// hash is set for the # in plural cases, it is the number selecting
+	// the case
+	hash bool
+}
+
+// argCount returns the number of arguments used by the message
+func (m *message) argCount() int {
+	count := 0
+	for _, part := range m.parts {
+		if part.arg+1 > count {
+			count = part.arg + 1
+		}
+		for _, c := range part.cases {
+			if n := c.argCount(); n > count {
+				count = n
+			}
+		}
+	}
+	for _, form := range m.forms {
+		if n := form.argCount(); n > count {
+			count = n
+		}
+	}
+	if len(m.forms) > 0 && count == 0 {
+		count = 1
+	}
+	return count
+}
+
+// messageContext is the locale and arguments used to format a message. The
+// tag selects the plural rules.
+type messageContext struct {
+	locale *Locale
+	tag    string
+	args   []interface{}
+}
+
+// format writes the message. The number is the value for # in plural cases.
+func (m *message) format(b *strings.Builder, ctx *messageContext, number interface{}) {
+	if len(m.forms) > 0 {
+		index := 0
+		if len(ctx.args) > 0 {
+			if n, ok := numberValue(ctx.args[0]); ok {
+				index = m.plural.index(int64(asFloat64(n)))
+			}
+		}
+		if index >= len(m.forms) {
+			index = len(m.forms) - 1
+		}
+		m.forms[index].format(b, ctx, number)
+		return
+	}
+	for _, part := range m.parts {
+		switch {
+		case part.hash:
+			if number != nil {
+				b.WriteString(localizeNumber(ctx.locale, formatNumber(number, -1)))
+			}
+		case part.arg < 0:
+			b.WriteString(part.text)
+		default:
+			part.format(b, ctx)
+		}
+	}
+}
+
+// format writes an argument
+func (part *messagePart) format(b *strings.Builder, ctx *messageContext) {
+	if part.arg >= len(ctx.args) {
+		return
+	}
+	v := ctx.args[part.arg]
+	switch part.typ {
+	case "", "number":
+		if n, ok := numberValue(v); ok && !isNotFinite(n) {
+			b.WriteString(localizeNumber(ctx.locale, formatNumber(n, -1)))
+			return
+		}
+		b.WriteString(formatValue(v))
+	case "date":
+		if t, ok := timeValue(v); ok {
+			layout := ctx.locale.DateFormats[part.style]
+			if layout == "" {
+				layout = bundledLocales[0].DateFormats[part.style]
+			}
+			b.WriteString(formatDate(ctx.locale, t.UTC(), layout))
+			return
+		}
+		b.WriteString(formatValue(v))
+	case "plural":
+		n, ok := numberValue(v)
+		if !ok {
+			n = int64(0)
+		}
+		selectCase(part.cases, pluralKeys(ctx.tag, n)).format(b, ctx, n)
+	case "select":
+		selectCase(part.cases, []string{formatValue(v)}).format(b, ctx, nil)
+	}
+}
+
+// pluralKeys returns the case keys for a number in the order they are
+// tried, the exact value before the plural category
+func pluralKeys(tag string, n interface{}) []string {
+	return []string{"=" + formatNumber(n, -1), pluralCategory(tag, n)}
+}
+
+// selectCase returns the first case matching one of the keys or the other
+// case
+func selectCase(cases map[string]*message, keys []string) *message {
+	for _, key := range keys {
+		if c, ok := cases[key]; ok {
+			return c
+		}
+	}
+	return cases["other"]
+}
+
+// pluralCategories are the valid plural case keywords
+var pluralCategories = map[string]bool{
+	"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true,
+}
+
+// messageParser parses messages in a subset of the ICU MessageFormat
+// syntax. Arguments are numbered from 0, ie "{0} is offline", and can have
+// a type: "{0, number}", "{0, date, short}",
+// "{0, plural, =0 {none} one {# item} other {# items}}" and
+// "{0, select, a {A} other {B}}". Apostrophes quote special characters and
+// two apostrophes are an apostrophe.
+type messageParser struct {
+	input string
+	pos   int
+}
+
+// parseMessage parses a message in the ICU syntax
+func parseMessage(s string) (*message, error) {
+	p := &messageParser{input: s}
+	m, err := p.parse(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected } at %d in %q", p.pos, s)
+	}
+	return m, nil
+}
+
+// parseCases parses plural or select cases without the argument, ie
+// "one {# item} other {# items}"
+func parseCases(s string, plural bool) (map[string]*message, error) {
+	p := &messageParser{input: s}
+	cases, err := p.cases(plural)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected } at %d in %q", p.pos, s)
+	}
+	return cases, nil
+}
+
+// parsePluralCase parses the text for a plural case, ie "# items"
+func parsePluralCase(s string) (*message, error) {
+	p := &messageParser{input: s}
+	m, err := p.parse(true)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected } at %d in %q", p.pos, s)
+	}
+	return m, nil
+}
+
+// parse parses a message up to the end of the input or the } closing a case
+func (p *messageParser) parse(inPlural bool) (*message, error) {
+	m := &message{}
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			m.parts = append(m.parts, messagePart{text: text.String(), arg: -1})
+			text.Reset()
+		}
+	}
+	for p.pos < len(p.input) {
+		ch := p.input[p.pos]
+		switch {
+		case ch == '\'':
+			p.quoted(&text, inPlural)
+		case ch == '{':
+			flush()
+			part, err := p.argument()
+			if err != nil {
+				return nil, err
+			}
+			m.parts = append(m.parts, part)
+		case ch == '}':
+			flush()
+			return m, nil
+		case ch == '#' && inPlural:
+			flush()
+			m.parts = append(m.parts, messagePart{hash: true, arg: -1})
+			p.pos++
+		default:
+			text.WriteByte(ch)
+			p.pos++
+		}
+	}
+	flush()
+	return m, nil
+}
+
+// quoted handles an apostrophe. Two apostrophes are an apostrophe and an
+// apostrophe before a special character starts quoted text up to the next
+// apostrophe. Other apostrophes are written as is.
+func (p *messageParser) quoted(text *strings.Builder, inPlural bool) {
+	p.pos++
+	if p.pos < len(p.input) && p.input[p.pos] == '\'' {
+		text.WriteByte('\'')
+		p.pos++
+		return
+	}
+	if p.pos >= len(p.input) || !strings.ContainsRune("{}", rune(p.input[p.pos])) && !(inPlural && p.input[p.pos] == '#') {
+		text.WriteByte('\'')
+		return
+	}
+	for p.pos < len(p.input) {
+		if p.input[p.pos] == '\'' {
+			if p.pos+1 < len(p.input) && p.input[p.pos+1] == '\'' {
+				text.WriteByte('\'')
+				p.pos += 2
+				continue
+			}
+			p.pos++
+			return
+		}
+		text.WriteByte(p.input[p.pos])
+		p.pos++
+	}
+}
+
+func (p *messageParser) skipSpace() {
+	for p.pos < len(p.input) && isSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// word returns the next word, up to a space, comma or brace
+func (p *messageParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.input) && !isSpace(p.input[p.pos]) && !strings.ContainsRune(",{}", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+// expect consumes the character after optional spaces
+func (p *messageParser) expect(ch byte) error {
+	p.skipSpace()
+	if p.pos >= len(p.input) || p.input[p.pos] != ch {
+		return fmt.Errorf("expected %q at %d in %q", ch, p.pos, p.input)
+	}
+	p.pos++
+	return nil
+}
+
+// argument parses an argument starting at the {
+func (p *messageParser) argument() (messagePart, error) {
+	p.pos++
+	name := p.word()
+	arg, err := strconv.Atoi(name)
+	if err != nil || arg < 0 {
+		return messagePart{}, fmt.Errorf("invalid argument %q in %q, arguments are numbered from 0", name, p.input)
+	}
+	part := messagePart{arg: arg}
+	if p.skipSpace(); p.pos < len(p.input) && p.input[p.pos] == ',' {
+		p.pos++
+		part.typ = p.word()
+		switch part.typ {
+		case "number":
+		case "date":
+			part.style = "medium"
+			if p.skipSpace(); p.pos < len(p.input) && p.input[p.pos] == ',' {
+				p.pos++
+				part.style = p.word()
+				if !dateStyles[part.style] {
+					return messagePart{}, fmt.Errorf("invalid date style %q in %q", part.style, p.input)
+				}
+			}
+		case "plural", "select":
+			if err := p.expect(','); err != nil {
+				return messagePart{}, err
+			}
+			if part.cases, err = p.cases(part.typ == "plural"); err != nil {
+				return messagePart{}, err
+			}
+		default:
+			return messagePart{}, fmt.Errorf("invalid argument type %q in %q", part.typ, p.input)
+		}
+	}
+	return part, p.expect('}')
+}
+
+// cases parses the cases of plural and select arguments up to the } closing
+// the argument. The other case is required.
+func (p *messageParser) cases(plural bool) (map[string]*message, error) {
+	cases := make(map[string]*message)
+	for {
+		if p.skipSpace(); p.pos >= len(p.input) || p.input[p.pos] == '}' {
+			break
+		}
+		key := p.word()
+		if key == "" {
+			return nil, fmt.Errorf("expected case at %d in %q", p.pos, p.input)
+		}
+		if plural && !pluralCategories[key] {
+			if _, err := strconv.ParseFloat(strings.TrimPrefix(key, "="), 64); err != nil || key[0] != '=' {
+				return nil, fmt.Errorf("invalid plural case %q in %q", key, p.input)
+			}
+			if n, ok := numberValue(json.Number(key[1:])); ok {
+				key = "=" + formatNumber(n, -1)
+			}
+		}
+		if err := p.expect('{'); err != nil {
+			return nil, err
+		}
+		c, err := p.parse(plural)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect('}'); err != nil {
+			return nil, err
+		}
+		cases[key] = c
+	}
+	if cases["other"] == nil {
+		return nil, fmt.Errorf("missing other case in %q", p.input)
+	}
+	return cases, nil
+}
+
+// parsePrintf parses a gettext message with printf verbs, ie "%s is %d".
+// The verbs are the arguments in order or by index, ie "%[2]s", and %% is a
+// percent sign.
+func parsePrintf(s string) *message {
+	m := &message{}
+	var text strings.Builder
+	next := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+1 >= len(s) {
+			text.WriteByte(s[i])
+			continue
+		}
+		if s[i+1] == '%' {
+			text.WriteByte('%')
+			i++
+			continue
+		}
+		j := i + 1
+		arg := next
+		if s[j] == '[' {
+			end := strings.IndexByte(s[j:], ']')
+			if end < 0 {
+				text.WriteByte(s[i])
+				continue
+			}
+			n, err := strconv.Atoi(s[j+1 : j+end])
+			if err != nil || n < 1 {
+				text.WriteByte(s[i])
+				continue
+			}
+			arg = n - 1
+			j += end + 1
+		}
+		for j < len(s) && strings.IndexByte("+-# 0123456789.", s[j]) >= 0 {
+			j++
+		}
+		if j >= len(s) || !strings.ContainsRune("svdfgqxX", rune(s[j])) {
+			text.WriteByte(s[i])
+			continue
+		}
+		if text.Len() > 0 {
+			m.parts = append(m.parts, messagePart{text: text.String(), arg: -1})
+			text.Reset()
+		}
+		m.parts = append(m.parts, messagePart{arg: arg})
+		next = arg + 1
+		i = j
+	}
+	if text.Len() > 0 {
+		m.parts = append(m.parts, messagePart{text: text.String(), arg: -1})
+	}
+	return m
+}
@@ -0,0 +1,121 @@
+package goplate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	mqttSeparator      = "/"
+	mqttSingleLevel    = "+"
+	mqttMultiLevel     = "#"
+	mqttReservedInText = mqttSingleLevel + mqttMultiLevel
+)
+
+// filterLevel is a level in an MQTT subscription filter
+type filterLevel struct {
+	text     strings.Builder
+	wildcard bool
+}
+
+// SubscriptionFilter returns an MQTT subscription filter matching the topics
+// rendered by the template. Levels with fields or expressions are replaced by
+// "+" and the rest of the topic is replaced by "#" from the level where the
+// number of levels can't be predicted, ie at transforms, conditional sections
+// and partials. Fields are assumed to not contain "/".
+//
+// The bindings are field values that are used as is in the filter instead of
+// wildcards. The keys are the field paths as used in the template, ie
+// map[string]string{"tenant.id": "acme"}.
+func (t *Template) SubscriptionFilter(bindings map[string]string) (string, error) {
+	bound, err := t.checkBindings(bindings)
+	if err != nil {
+		return "", err
+	}
+
+	levels := []*filterLevel{{}}
+	current := func() *filterLevel { return levels[len(levels)-1] }
+	multiLevel := false
+loop:
+	for _, node := range t.tree.Nodes {
+		switch n := node.(type) {
+		case *TextNode:
+			if strings.ContainsAny(n.Text, mqttReservedInText) {
+				return "", fmt.Errorf("text at %s contains MQTT wildcards", n.Pos)
+			}
+			for i, level := range strings.Split(n.Text, mqttSeparator) {
+				if i > 0 {
+					levels = append(levels, &filterLevel{})
+				}
+				current().text.WriteString(level)
+			}
+
+		case *CommentNode, *AssignNode:
+			// These don't render anything
+
+		case *ActionNode:
+			if len(n.Pipe.Transforms) > 0 {
+				multiLevel = true
+				break loop
+			}
+			if field, ok := n.Pipe.Expr.(*FieldNode); ok && field.Variable == "" && !field.HasKey {
+				if v, ok := bound[field.Path]; ok {
+					current().text.WriteString(v)
+					break
+				}
+			}
+			current().wildcard = true
+
+		default:
+			multiLevel = true
+			break loop
+		}
+	}
+
+	filter := make([]string, 0, len(levels))
+	for i, level := range levels {
+		switch {
+		case multiLevel && i == len(levels)-1:
+			filter = append(filter, mqttMultiLevel)
+		case level.wildcard:
+			filter = append(filter, mqttSingleLevel)
+		default:
+			filter = append(filter, level.text.String())
+		}
+	}
+	return strings.Join(filter, mqttSeparator), nil
+}
+
+// checkBindings checks that the bound fields are used in the template and
+// that the values are valid in a topic level. The keys are returned in lower
+// case.
+func (t *Template) checkBindings(bindings map[string]string) (map[string]string, error) {
+	fields := make(map[string]bool)
+	Walk(t.tree, func(n Node) bool {
+		if f, ok := n.(*FieldNode); ok && f.Variable == "" && !f.HasKey {
+			fields[f.Path] = true
+		}
+		return true
+	})
+
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := make(map[string]string)
+	for _, name := range names {
+		v := bindings[name]
+		path := strings.ToLower(name)
+		if !fields[path] {
+			return nil, fmt.Errorf("%s isn't a field in the template", name)
+		}
+		if strings.ContainsAny(v, mqttSeparator+mqttReservedInText) {
+			return nil, fmt.Errorf("value for %s can't contain %q, %q or %q", name, mqttSeparator, mqttSingleLevel, mqttMultiLevel)
+		}
+		ret[path] = v
+	}
+	return ret, nil
+}
@@ -0,0 +1,57 @@
+package goplate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionFilter(t *testing.T) {
+	assert := require.New(t)
+
+	type filterTest struct {
+		bindings map[string]string
+		filter   string
+	}
+	tests := map[string][]filterTest{
+		`tenants/{{ substructure.string }}/devices/{{ int32 }}/up`: {
+			{nil, "tenants/+/devices/+/up"},
+			{map[string]string{"Substructure.String": "acme"}, "tenants/acme/devices/+/up"},
+			{map[string]string{"substructure.string": "acme", "int32": "1"}, "tenants/acme/devices/1/up"},
+		},
+		`a/dev-{{ int32 }}/{{ int32 * 2 }}{{/* comment */}}`: {
+			{nil, "a/+/+"},
+			{map[string]string{"int32": "1"}, "a/dev-1/+"},
+		},
+		`a/{{ string | json }}/b`:                      {{nil, "a/#"}},
+		`a/x{{ int32 }}/y{{ string | json }}/b/c`:      {{nil, "a/+/#"}},
+		`/{{ if int32 > 1 }}x{{ end }}/b`:              {{nil, "/#"}},
+		`{{ $s := string }}{{ $s }}/{{ include "p" }}`: {{nil, "+/#"}},
+	}
+	for tmplStr, cases := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).WithPartial("p", "x").Build()
+		assert.NoError(err, tmplStr)
+		for _, c := range cases {
+			filter, err := tmpl.SubscriptionFilter(c.bindings)
+			assert.NoError(err, tmplStr)
+			assert.Equal(c.filter, filter, tmplStr)
+		}
+	}
+
+	tmpl, err := New(`a/{{ int32 }}/{{ string }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	for _, invalid := range []map[string]string{
+		{"int64": "1"},
+		{"string": "a/b"},
+		{"string": "+"},
+		{"int32": "#"},
+	} {
+		_, err := tmpl.SubscriptionFilter(invalid)
+		assert.Error(err, invalid)
+	}
+
+	tmpl, err = New(`a/+/{{ int32 }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	_, err = tmpl.SubscriptionFilter(nil)
+	assert.Error(err)
+}
@@ -0,0 +1,413 @@
+package goplate
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultLeftDelimiter  = "{{"
+	defaultRightDelimiter = "}}"
+	// Trim markers in tags. The marker must be separated from the tag
+	// contents by whitespace so "{{-3}}" is still a negative number.
+	trimMarker = "-"
+	// Escape character for literal left delimiters, ie "\\{{" is written as
+	// "{{" and "\\\\{{" is a backslash followed by a tag
+	escapeChar   = '\\'
+	commentStart = "/*"
+	commentEnd   = "*/"
+	// Raw blocks are copied verbatim to the output. The marker isn't valid in
+	// expressions so the tags can't be mistaken for fields.
+	rawMarker = "#"
+	rawStart  = "raw"
+	rawEnd    = "endraw"
+)
+
+// Parse parses a template with the default delimiters and returns the syntax
+// tree. Errors in tags are returned together with the rest of the tree, the
+// tree is nil if the structure of the template is broken, ie a tag or a
+// section isn't closed. Parsing doesn't need the parameters so fields and
+// types aren't checked, use Builder.Build for that.
+func Parse(templateStr string) (*ListNode, error) {
+	return parse(templateStr, defaultLeftDelimiter, defaultRightDelimiter)
+}
+
+func parse(templateStr string, left string, right string) (*ListNode, error) {
+	tree, errs, err := parseTemplate(templateStr, left, right)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return tree, fmt.Errorf("template parse error (%s)", strings.Join(errs, ", "))
+	}
+	return tree, nil
+}
+
+// tagItem is a tag opening or closing a section
+type tagItem struct {
+	pos    Pos
+	action *actionNode
+}
+
+// templateParser splits the template into static text and tags and builds
+// the syntax tree. Tags starting with "{{- " trims the whitespace at the end
+// of the preceding text and tags ending with " -}}" trims the whitespace at
+// the start of the following text. Comments ("{{/* ... */}}") render nothing,
+// "\\{{" is a literal "{{" and the contents of "{{# raw }} ... {{# endraw }}"
+// is copied verbatim. The same rules apply for custom delimiters.
+type templateParser struct {
+	input string
+	left  string
+	right string
+	pos   int
+	lines lineIndex
+	// errs are the errors in tags. Tags with errors are skipped and the
+	// parsing continues so all errors are reported.
+	errs []string
+	// lastText is the text immediately before the current position, it is
+	// trimmed by a following left trim marker.
+	lastText *TextNode
+	trimNext bool
+}
+
+// parseTemplate parses the template. Errors in the structure of the template
+// are returned as an error, errors in tags are returned as a list.
+func parseTemplate(templateStr string, left string, right string) (*ListNode, []string, error) {
+	p := &templateParser{input: templateStr, left: left, right: right, lines: newLineIndex(templateStr)}
+	list, _, err := p.parseList(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return list, p.errs, nil
+}
+
+func parseError(format string, args ...interface{}) error {
+	return fmt.Errorf("template parse error (%s)", fmt.Sprintf(format, args...))
+}
+
+func (p *templateParser) addError(pos Pos, err error) {
+	p.errs = append(p.errs, fmt.Sprintf("%s: %v", pos, err))
+}
+
+// parseList parses nodes until the end of the template or an else or end tag
+// closing the section. The tag ending the list is returned. Outside sections
+// else and end are fields, ie `{{ end }}` renders the field End.
+func (p *templateParser) parseList(inSection bool) (*ListNode, *tagItem, error) {
+	list := &ListNode{Pos: p.lines.position(p.pos)}
+	for {
+		node, tag, err := p.next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if node != nil {
+			list.Nodes = append(list.Nodes, node)
+			continue
+		}
+		if tag == nil || inSection && (tag.action.typ == actionElse || tag.action.typ == actionEnd) {
+			dropEmptyText(list)
+			return list, tag, nil
+		}
+
+		action := tag.action
+		switch action.typ {
+		case actionIf:
+			n := &IfNode{Pos: tag.pos, Cond: action.pipeline}
+			var end *tagItem
+			if n.List, end, err = p.parseSection(tag); err != nil {
+				return nil, nil, err
+			}
+			if end.action.typ == actionElse {
+				if n.ElseList, end, err = p.parseSection(tag); err != nil {
+					return nil, nil, err
+				}
+				if end.action.typ == actionElse {
+					return nil, nil, parseError("unexpected else at %s", end.pos)
+				}
+			}
+			list.Nodes = append(list.Nodes, n)
+
+		case actionBlock, actionDefine:
+			section, end, err := p.parseSection(tag)
+			if err != nil {
+				return nil, nil, err
+			}
+			if end.action.typ == actionElse {
+				return nil, nil, parseError("unexpected else at %s", end.pos)
+			}
+			if action.typ == actionBlock {
+				list.Nodes = append(list.Nodes, &BlockNode{Pos: tag.pos, Name: action.name, List: section})
+			} else {
+				list.Nodes = append(list.Nodes, &DefineNode{Pos: tag.pos, Name: action.name, List: section})
+			}
+
+		case actionExtends:
+			list.Nodes = append(list.Nodes, &ExtendsNode{Pos: tag.pos, Name: action.name})
+
+		case actionAssign:
+			list.Nodes = append(list.Nodes, &AssignNode{Pos: tag.pos, Variable: action.variable, Pipe: action.pipeline})
+
+		case actionInclude:
+			list.Nodes = append(list.Nodes, &IncludeNode{Pos: tag.pos, Name: action.name, Pipe: action.pipeline})
+
+		default:
+			if action.pipeline == nil {
+				// An else or end with errors outside a section, the error
+				// has already been reported
+				continue
+			}
+			list.Nodes = append(list.Nodes, &ActionNode{Pos: tag.pos, Pipe: action.pipeline})
+		}
+	}
+}
+
+// parseSection parses the contents of a section and returns the else or end
+// tag closing it.
+func (p *templateParser) parseSection(start *tagItem) (*ListNode, *tagItem, error) {
+	list, end, err := p.parseList(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if end == nil {
+		return nil, nil, parseError("%s at %s isn't closed", start.action.typ, start.pos)
+	}
+	return list, end, nil
+}
+
+// dropEmptyText removes text nodes that are empty after trimming
+func dropEmptyText(list *ListNode) {
+	nodes := list.Nodes[:0]
+	for _, node := range list.Nodes {
+		if text, ok := node.(*TextNode); ok && text.Text == "" {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	list.Nodes = nodes
+}
+
+// next returns the next text or comment node or the next tag. Both are nil at
+// the end of the template.
+func (p *templateParser) next() (Node, *tagItem, error) {
+	input := p.input
+	if p.pos >= len(input) {
+		return nil, nil, nil
+	}
+	start := p.pos
+	var text strings.Builder
+	for {
+		idx := strings.Index(input[p.pos:], p.left)
+		if idx < 0 {
+			text.WriteString(input[p.pos:])
+			p.pos = len(input)
+			break
+		}
+		idx += p.pos
+		// Backslashes before the delimiter escape each other in pairs, an
+		// odd one escapes the delimiter
+		n := 0
+		for idx-n > p.pos && input[idx-n-1] == escapeChar {
+			n++
+		}
+		text.WriteString(input[p.pos : idx-n])
+		text.WriteString(strings.Repeat(string(escapeChar), n/2))
+		if n%2 == 1 {
+			text.WriteString(p.left)
+			p.pos = idx + len(p.left)
+			continue
+		}
+		p.pos = idx
+		break
+	}
+	if text.Len() > 0 {
+		return p.textNode(start, text.String()), nil, nil
+	}
+	return p.tag()
+}
+
+// textNode returns a text node, trimmed if the preceding tag has a trim
+// marker.
+func (p *templateParser) textNode(pos int, text string) *TextNode {
+	if p.trimNext {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		p.trimNext = false
+	}
+	n := &TextNode{Pos: p.lines.position(pos), Text: text}
+	p.lastText = n
+	return n
+}
+
+// tag parses the tag at the current position. Comments and raw blocks are
+// returned as nodes, tags with errors are skipped.
+func (p *templateParser) tag() (Node, *tagItem, error) {
+	input := p.input
+	pos := p.lines.position(p.pos)
+	p.pos += len(p.left)
+
+	trimmed := false
+	if hasLeftTrimMarker(input[p.pos:]) {
+		p.pos += len(trimMarker)
+		trimmed = true
+		if p.lastText != nil {
+			p.lastText.Text = strings.TrimRightFunc(p.lastText.Text, unicode.IsSpace)
+		}
+	}
+	rest := input[p.pos:]
+	if trimmed {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	}
+	if strings.HasPrefix(rest, commentStart) {
+		p.pos = len(input) - len(rest)
+		return p.comment(pos)
+	}
+	if strings.HasPrefix(rest, rawMarker) {
+		p.pos = len(input) - len(rest)
+		return p.raw(pos)
+	}
+
+	l := &lexer{input: input, pos: p.pos, right: p.right, lines: p.lines}
+	tokens, trimNext, err := l.lex()
+	if err == errTagNotClosed {
+		return nil, nil, parseError("tag at %s isn't closed", pos)
+	}
+	if err != nil {
+		p.addError(pos, err)
+		// Skip the rest of the tag
+		end := strings.Index(input[l.pos:], p.right)
+		if end < 0 {
+			return nil, nil, parseError("tag at %s isn't closed", pos)
+		}
+		p.pos = l.pos + end + len(p.right)
+		p.lastText = nil
+		// Keep tags opening and closing sections so the structure is intact.
+		// The condition is missing so if can't be told apart from a field.
+		action, _ := parseTokens(append(tokens, token{typ: tokenEOF, pos: l.pos}), p.lines)
+		if len(tokens) > 0 && tokens[0].typ == tokenIdent && tokens[0].val == "if" {
+			action.typ = actionIf
+		}
+		if !action.typ.isStructural() {
+			return p.next()
+		}
+		action.pipeline = nil
+		return nil, &tagItem{pos: pos, action: action}, nil
+	}
+	p.pos = l.pos
+	p.lastText = nil
+	p.trimNext = trimNext
+	action, err := parseTokens(tokens, p.lines)
+	if err != nil {
+		p.addError(pos, err)
+		if !action.typ.isStructural() {
+			return p.next()
+		}
+	}
+	return nil, &tagItem{pos: pos, action: action}, nil
+}
+
+// comment parses a comment. The position is at the start of the comment
+// text. Comments can't be nested and trim markers work like for other tags.
+func (p *templateParser) comment(pos Pos) (Node, *tagItem, error) {
+	input := p.input
+	start := p.pos + len(commentStart)
+	end := strings.Index(input[start:], commentEnd)
+	if end < 0 {
+		return nil, nil, parseError("comment at %s isn't closed", pos)
+	}
+	n := &CommentNode{Pos: pos, Text: input[start : start+end]}
+	after := start + end + len(commentEnd)
+	rest := strings.TrimLeftFunc(input[after:], unicode.IsSpace)
+	switch {
+	case len(rest) < len(input[after:]) && strings.HasPrefix(rest, trimMarker+p.right):
+		p.pos = len(input) - len(rest) + len(trimMarker) + len(p.right)
+		p.trimNext = true
+	case strings.HasPrefix(rest, p.right):
+		p.pos = len(input) - len(rest) + len(p.right)
+	default:
+		return nil, nil, parseError("comment at %s isn't closed", pos)
+	}
+	return n, nil, nil
+}
+
+// raw returns the contents of a raw block as a text node. The position is at
+// the raw marker of the opening tag. Trim markers on the raw tags trim the
+// contents but any pending trim from the preceding tag doesn't apply.
+func (p *templateParser) raw(pos Pos) (Node, *tagItem, error) {
+	input := p.input
+	end := strings.Index(input[p.pos:], p.right)
+	if end < 0 {
+		return nil, nil, parseError("tag at %s isn't closed", pos)
+	}
+	name, trimStart, _ := rawTag(input[p.pos : p.pos+end])
+	p.pos += end + len(p.right)
+	p.lastText = nil
+	if name != rawStart {
+		p.addError(pos, fmt.Errorf("unexpected raw tag %q", name))
+		p.trimNext = trimStart
+		return p.next()
+	}
+	p.trimNext = false
+
+	for i := p.pos; ; {
+		idx := strings.Index(input[i:], p.left)
+		if idx < 0 {
+			return nil, nil, parseError("raw at %s isn't closed", pos)
+		}
+		idx += i
+		start := idx + len(p.left)
+		end := strings.Index(input[start:], p.right)
+		if end < 0 {
+			return nil, nil, parseError("raw at %s isn't closed", pos)
+		}
+		end += start
+		tag := input[start:end]
+		trimLeft := false
+		if hasLeftTrimMarker(tag) {
+			tag = strings.TrimLeftFunc(tag[len(trimMarker):], unicode.IsSpace)
+			trimLeft = true
+		}
+		name, trimRight, ok := rawTag(tag)
+		if !ok || name != rawEnd {
+			i = start
+			continue
+		}
+
+		content := input[p.pos:idx]
+		if trimStart {
+			content = strings.TrimLeftFunc(content, unicode.IsSpace)
+		}
+		if trimLeft {
+			content = strings.TrimRightFunc(content, unicode.IsSpace)
+		}
+		n := &TextNode{Pos: p.lines.position(p.pos), Text: content}
+		p.lastText = n
+		p.trimNext = trimRight
+		p.pos = end + len(p.right)
+		return n, nil, nil
+	}
+}
+
+// rawTag returns the name in a raw tag, ie "raw" for "# raw -", and if the
+// tag ends with a trim marker. ok is false if the tag isn't a raw tag.
+func rawTag(tag string) (name string, trim bool, ok bool) {
+	if !strings.HasPrefix(tag, rawMarker) {
+		return "", false, false
+	}
+	tag = tag[len(rawMarker):]
+	if hasRightTrimMarker(tag) {
+		tag = tag[:len(tag)-len(trimMarker)]
+		trim = true
+	}
+	return strings.TrimSpace(tag), trim, true
+}
+
+func hasLeftTrimMarker(tag string) bool {
+	return len(tag) > len(trimMarker) && strings.HasPrefix(tag, trimMarker) && isSpace(tag[len(trimMarker)])
+}
+
+func hasRightTrimMarker(tag string) bool {
+	return len(tag) > len(trimMarker) && strings.HasSuffix(tag, trimMarker) && isSpace(tag[len(tag)-len(trimMarker)-1])
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'
+}
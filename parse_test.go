@@ -0,0 +1,162 @@
+package goplate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	assert := require.New(t)
+
+	tree, err := Parse("a {{ some.map[\"na}me\"] }}\n{{ if x > 1 }}{{ \"|\" | json | hex }}{{ else }}b{{ end }}")
+	assert.NoError(err)
+	assert.Len(tree.Nodes, 4)
+
+	text, ok := tree.Nodes[0].(*TextNode)
+	assert.True(ok)
+	assert.Equal("a ", text.Text)
+
+	action, ok := tree.Nodes[1].(*ActionNode)
+	assert.True(ok)
+	field, ok := action.Pipe.Expr.(*FieldNode)
+	assert.True(ok)
+	assert.Equal("some.map", field.Path)
+	assert.True(field.HasKey)
+	assert.Equal("na}me", field.Key)
+	assert.Equal(Pos{Offset: 2, Line: 1, Column: 3}, action.Position())
+
+	ifNode, ok := tree.Nodes[3].(*IfNode)
+	assert.True(ok)
+	assert.Equal(Pos{Offset: 26, Line: 2, Column: 1}, ifNode.Position())
+	assert.Equal(">", ifNode.Cond.Expr.(*BinaryNode).Op)
+	assert.Len(ifNode.List.Nodes, 1)
+	pipe := ifNode.List.Nodes[0].(*ActionNode).Pipe
+	assert.Equal("|", pipe.Expr.(*LiteralNode).Value)
+	assert.Len(pipe.Transforms, 2)
+	assert.Equal("hex", pipe.Transforms[1].Name)
+	assert.Equal("b", ifNode.ElseList.Nodes[0].(*TextNode).Text)
+
+	// The string form can be parsed again
+	again, err := Parse(tree.String())
+	assert.NoError(err)
+	assert.Equal(tree.String(), again.String())
+	assert.Equal("a {{ some.map[\"na}me\"] }}\n{{ if x > 1 }}{{ \"|\" | json | hex }}{{ else }}b{{ end }}", tree.String())
+
+	// Errors in tags are reported but the rest of the tree is kept
+	tree, err = Parse(`{{ a + }} {{ b }} {{ if c{} }}x{{ end }}`)
+	assert.Error(err)
+	assert.NotNil(tree)
+	assert.Len(tree.Nodes, 4)
+
+	tree, err = Parse(`{{ a | truncate -3 "…" | x true 1.5 | y }}`)
+	assert.NoError(err)
+	pipe = tree.Nodes[0].(*ActionNode).Pipe
+	assert.Len(pipe.Transforms, 3)
+	assert.Equal([]interface{}{int64(-3), "…"}, []interface{}{pipe.Transforms[0].Args[0].Value, pipe.Transforms[0].Args[1].Value})
+	assert.Equal(Pos{Offset: 16, Line: 1, Column: 17}, pipe.Transforms[0].Args[0].Pos)
+	assert.Len(pipe.Transforms[1].Args, 2)
+	assert.Empty(pipe.Transforms[2].Args)
+	assert.Equal(`{{ a | truncate -3 "…" | x true 1.5 | y }}`, tree.String())
+
+	// t is a message when followed by the key and a field otherwise
+	tree, err = Parse(`{{ t "device.offline" device.name (a + 1) -2 | upper }}{{ t }}`)
+	assert.NoError(err)
+	pipe = tree.Nodes[0].(*ActionNode).Pipe
+	msg, ok := pipe.Expr.(*MessageNode)
+	assert.True(ok)
+	assert.Equal("device.offline", msg.Key)
+	assert.Len(msg.Args, 3)
+	assert.Len(pipe.Transforms, 1)
+	assert.Equal("t", tree.Nodes[1].(*ActionNode).Pipe.Expr.(*FieldNode).Path)
+	assert.Equal(`{{ t "device.offline" device.name (a + 1) -2 | upper }}{{ t }}`, tree.String())
+
+	// Trees from failed parses can be written
+	tree, err = Parse("{{ if @ }}x{{ end }}")
+	assert.Error(err)
+	assert.Equal("{{ if }}x{{ end }}", tree.String())
+
+	for _, invalid := range []string{`{{ a`, `{{ "}}`, `{{ if a }}`, `{{ end @ }}`, `{{ block "a" }}{{ else }}{{ end }}`, `{{ a | x b }}`, `{{ a | x -"s" }}`, `{{ a | x (1) }}`} {
+		_, err := Parse(invalid)
+		assert.Error(err, invalid)
+	}
+}
+
+func TestKeywordFields(t *testing.T) {
+	assert := require.New(t)
+
+	type keywords struct {
+		If   int
+		Else string
+		End  int
+	}
+	params := &keywords{If: 1, Else: "e", End: 5}
+
+	// if, else and end are fields outside keyword positions
+	tests := map[string]string{
+		`{{ end }}`:                           "5",
+		`{{ else }}/{{ if }}`:                 "e/1",
+		`{{ if == 1 }}`:                       "true",
+		`{{ end | json }}`:                    "5",
+		`{{ if if > 0 }}{{ (end) }}{{ end }}`: "5",
+		`{{ if end > 1 }}a{{ else }}b{{ end }}{{ else }}`: "ae",
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&keywords{}).Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(params)
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	assert := require.New(t)
+
+	tree, err := New(`{{ $v := substructure }}{{ if $v.bool && int32 > 0 }}{{ $v.map["name"] | json }}{{ end }}`).
+		WithParameters(&testStructure{}).
+		Parse()
+	assert.NoError(err)
+
+	var fields []string
+	Walk(tree, func(n Node) bool {
+		if f, ok := n.(*FieldNode); ok {
+			fields = append(fields, f.String())
+		}
+		return true
+	})
+	assert.Equal([]string{"substructure", "$v.bool", "int32", `$v.map["name"]`}, fields)
+
+	// Returning false skips the children
+	count := 0
+	Walk(tree, func(n Node) bool {
+		count++
+		_, isIf := n.(*IfNode)
+		return !isIf
+	})
+	assert.Equal(5, count)
+}
+
+func TestParserEdgeCases(t *testing.T) {
+	assert := require.New(t)
+
+	params := &testStructure{
+		Int32:        2,
+		Substructure: &testSubStructure{Map: map[string]string{"na}me": "x", "a|b": "y"}},
+	}
+	tests := map[string][]string{
+		`{{ substructure.map["na}me"] }}/{{substructure.map["a|b"]}}`: {"{{", "}}", "x/y"},
+		`${ substructure.map["na}me"] }`:                              {"${", "}", "x"},
+		`{{ "}}" }}{{ "a|b" | json }}`:                                {"{{", "}}", `}}"a|b"`},
+		"{{ int32 -}}\n{{- int32 }}":                                  {"{{", "}}", "22"},
+	}
+	for tmplStr, v := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).WithDelimiters(v[0], v[1]).Build()
+		assert.NoError(err, tmplStr)
+		buf := &bytes.Buffer{}
+		assert.NoError(tmpl.Execute(buf, params))
+		assert.Equal(v[2], buf.String(), tmplStr)
+		assert.NotNil(tmpl.Tree())
+	}
+}
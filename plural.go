@@ -0,0 +1,387 @@
+package goplate
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// pluralOperands are the CLDR plural operands for a number: the absolute
+// value n, the integer digits i, the number of fraction digits v and the
+// fraction digits without trailing zeros t.
+type pluralOperands struct {
+	n float64
+	i int64
+	v int
+	t int64
+}
+
+// newPluralOperands returns the operands for a number from numberValue
+func newPluralOperands(number interface{}) pluralOperands {
+	if i, ok := number.(int64); ok {
+		if i < 0 {
+			i = -i
+		}
+		return pluralOperands{n: float64(i), i: i}
+	}
+	f := math.Abs(number.(float64))
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	ret := pluralOperands{n: f, i: int64(f)}
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		fraction := s[dot+1:]
+		ret.v = len(fraction)
+		ret.t, _ = strconv.ParseInt(strings.TrimRight(fraction, "0"), 10, 64)
+	}
+	return ret
+}
+
+// pluralRule returns the plural category for the operands
+type pluralRule func(o pluralOperands) string
+
+// pluralRules are the CLDR cardinal plural rules by language. Languages
+// without a rule use the English rule.
+var pluralRules = map[string]pluralRule{
+	"en": englishPlural,
+	"de": englishPlural,
+	"nl": englishPlural,
+	"sv": englishPlural,
+	"nb": englishPlural,
+	"no": englishPlural,
+	"fi": englishPlural,
+	"it": englishPlural,
+	"es": englishPlural,
+	"fr": frenchPlural,
+	"pt": frenchPlural,
+	"da": danishPlural,
+	"ja": otherPlural,
+	"zh": otherPlural,
+	"ko": otherPlural,
+	"th": otherPlural,
+	"vi": otherPlural,
+	"id": otherPlural,
+	"ru": russianPlural,
+	"uk": russianPlural,
+	"be": russianPlural,
+	"pl": polishPlural,
+	"cs": czechPlural,
+	"sk": czechPlural,
+}
+
+// pluralCategory returns the plural category for the number in the language
+// of the locale tag
+func pluralCategory(tag string, number interface{}) string {
+	rule, ok := pluralRules[pluralLanguage(tag)]
+	if !ok {
+		rule = englishPlural
+	}
+	return rule(newPluralOperands(number))
+}
+
+// hasPluralRules checks if there are plural rules for the language of the
+// locale tag
+func hasPluralRules(tag string) bool {
+	_, ok := pluralRules[pluralLanguage(tag)]
+	return ok
+}
+
+// pluralLanguage returns the base language of the locale tag, ie "de" for
+// "de-CH"
+func pluralLanguage(tag string) string {
+	return strings.ToLower(strings.SplitN(strings.ReplaceAll(tag, "_", "-"), "-", 2)[0])
+}
+
+func englishPlural(o pluralOperands) string {
+	if o.i == 1 && o.v == 0 {
+		return "one"
+	}
+	return "other"
+}
+
+func frenchPlural(o pluralOperands) string {
+	if o.i == 0 || o.i == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func danishPlural(o pluralOperands) string {
+	if o.n == 1 || o.t != 0 && (o.i == 0 || o.i == 1) {
+		return "one"
+	}
+	return "other"
+}
+
+func otherPlural(pluralOperands) string {
+	return "other"
+}
+
+func russianPlural(o pluralOperands) string {
+	if o.v != 0 {
+		return "other"
+	}
+	mod10, mod100 := o.i%10, o.i%100
+	switch {
+	case mod10 == 1 && mod100 != 11:
+		return "one"
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return "few"
+	}
+	return "many"
+}
+
+func polishPlural(o pluralOperands) string {
+	if o.v != 0 {
+		return "other"
+	}
+	mod10, mod100 := o.i%10, o.i%100
+	switch {
+	case o.i == 1:
+		return "one"
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return "few"
+	}
+	return "many"
+}
+
+func czechPlural(o pluralOperands) string {
+	switch {
+	case o.v != 0:
+		return "many"
+	case o.i == 1:
+		return "one"
+	case o.i >= 2 && o.i <= 4:
+		return "few"
+	}
+	return "other"
+}
+
+// pluralForms is the plural expression from the Plural-Forms header in
+// gettext files, ie "nplurals=2; plural=(n != 1);". The expression is a C
+// expression with n as the only variable.
+type pluralForms struct {
+	count int
+	eval  func(n int64) int64
+}
+
+// defaultPluralForms is used for gettext files without a Plural-Forms header
+var defaultPluralForms = &pluralForms{count: 2, eval: func(n int64) int64 {
+	if n != 1 {
+		return 1
+	}
+	return 0
+}}
+
+// parsePluralForms parses the value of a Plural-Forms header
+func parsePluralForms(header string) (*pluralForms, error) {
+	ret := &pluralForms{}
+	var expr string
+	for _, field := range strings.Split(header, ";") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "nplurals":
+			n, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid nplurals in %q", header)
+			}
+			ret.count = n
+		case "plural":
+			expr = kv[1]
+		}
+	}
+	if ret.count == 0 || expr == "" {
+		return nil, fmt.Errorf("invalid plural forms %q", header)
+	}
+	p := &pluralParser{input: expr}
+	eval, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected %q in plural expression", p.input[p.pos:])
+	}
+	ret.eval = eval
+	return ret, nil
+}
+
+// index returns the plural form for n
+func (f *pluralForms) index(n int64) int {
+	i := f.eval(n)
+	if i < 0 || i >= int64(f.count) {
+		return 0
+	}
+	return int(i)
+}
+
+// pluralParser parses plural expressions into functions. Booleans are 0 and
+// 1 like in C.
+type pluralParser struct {
+	input string
+	pos   int
+}
+
+type pluralExpr func(n int64) int64
+
+func (p *pluralParser) skipSpace() {
+	for p.pos < len(p.input) && isSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// accept consumes the operator if it is next
+func (p *pluralParser) accept(op string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.pos:], op) {
+		p.pos += len(op)
+		return true
+	}
+	return false
+}
+
+func (p *pluralParser) parseTernary() (pluralExpr, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil || !p.accept("?") {
+		return cond, err
+	}
+	yes, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept(":") {
+		return nil, fmt.Errorf("expected : in plural expression")
+	}
+	no, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	return func(n int64) int64 {
+		if cond(n) != 0 {
+			return yes(n)
+		}
+		return no(n)
+	}, nil
+}
+
+// pluralOperators are the binary operators by precedence, lowest first.
+// Longer operators come first so <= isn't read as <.
+var pluralOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<=", ">=", "<", ">"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *pluralParser) parseBinary(level int) (pluralExpr, error) {
+	if level == len(pluralOperators) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range pluralOperators[level] {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = pluralOperation(op, left, right)
+	}
+}
+
+func pluralOperation(op string, left, right pluralExpr) pluralExpr {
+	boolean := func(b bool) int64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	return func(n int64) int64 {
+		a, b := left(n), right(n)
+		switch op {
+		case "||":
+			return boolean(a != 0 || b != 0)
+		case "&&":
+			return boolean(a != 0 && b != 0)
+		case "==":
+			return boolean(a == b)
+		case "!=":
+			return boolean(a != b)
+		case "<=":
+			return boolean(a <= b)
+		case ">=":
+			return boolean(a >= b)
+		case "<":
+			return boolean(a < b)
+		case ">":
+			return boolean(a > b)
+		case "+":
+			return a + b
+		case "-":
+			return a - b
+		case "*":
+			return a * b
+		}
+		if b == 0 {
+			return 0
+		}
+		if op == "/" {
+			return a / b
+		}
+		return a % b
+	}
+}
+
+func (p *pluralParser) parseUnary() (pluralExpr, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(n int64) int64 {
+			if operand(n) == 0 {
+				return 1
+			}
+			return 0
+		}, nil
+	}
+	if p.accept("(") {
+		expr, err := p.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("expected ) in plural expression")
+		}
+		return expr, nil
+	}
+	if p.accept("n") {
+		return func(n int64) int64 { return n }, nil
+	}
+	start := p.pos
+	for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, fmt.Errorf("unexpected %q in plural expression", p.input[p.pos:])
+	}
+	v, err := strconv.ParseInt(p.input[start:p.pos], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return func(int64) int64 { return v }, nil
+}
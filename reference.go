@@ -0,0 +1,46 @@
+package goplate
+
+import "reflect"
+
+// Reference is a field used by a template.
+type Reference struct {
+	// Path is the lower case dot separated path to the field from the
+	// parameters. Fields relative to variables and fields in partials
+	// rendered with a sub-structure are resolved to the full path.
+	Path string
+	// Key is the map key for map lookups
+	Key    string
+	HasKey bool
+	// Transforms is the transform chain applied to the field. It is empty if
+	// the field is part of a larger expression.
+	Transforms []string
+	// Template is the name of the partial or base template with the field.
+	// It is empty for fields in the template itself.
+	Template string
+	// Pos is the position of the field in the template
+	Pos Pos
+	// Type is the Go type of the field. For map lookups it is the type of
+	// the map values.
+	Type reflect.Type
+}
+
+// References returns the fields used by the template in the order they are
+// compiled, including the fields used in partials and base templates. Fields
+// used more than once are listed once for each use.
+func (t *Template) References() []Reference {
+	ret := make([]Reference, len(t.references))
+	for i, ref := range t.references {
+		if ref.Transforms != nil {
+			ref.Transforms = append([]string(nil), ref.Transforms...)
+		}
+		ret[i] = ref
+	}
+	return ret
+}
+
+// Transforms returns the names of the transforms used by the template,
+// including the ones in partials and base templates. Each name is only
+// listed once.
+func (t *Template) Transforms() []string {
+	return append([]string(nil), t.transforms...)
+}
@@ -0,0 +1,57 @@
+package goplate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestReferences(t *testing.T) {
+	assert := require.New(t)
+
+	tmpl, err := New(`{{ extends "base" }}{{ define "body" }}{{ substructure.map["Name"] }}{{ end }}`).
+		WithParameters(&testStructure{}).
+		WithPartial("base", "{{ $s := substructure }}{{ if $s.bool }}{{ int64 | asTime }}{{ end }}\n{{ block \"body\" }}{{ end }}{{ template \"sub\" substructure.subsub }}").
+		WithPartial("sub", `{{ (int + 1) | json | hex }}`).
+		Build()
+	assert.NoError(err)
+
+	refs := tmpl.References()
+	assert.Len(refs, 6)
+
+	assert.Equal(Reference{Path: "substructure", Template: "base", Pos: Pos{Offset: 9, Line: 1, Column: 10}, Type: reflect.TypeOf(testSubStructure{})}, refs[0])
+	assert.Equal("substructure.bool", refs[1].Path)
+	assert.Equal(reflect.TypeOf(true), refs[1].Type)
+
+	assert.Equal("int64", refs[2].Path)
+	assert.Equal([]string{"asTime"}, refs[2].Transforms)
+	assert.Equal(reflect.TypeOf(int64(0)), refs[2].Type)
+
+	// The definition is in the template itself
+	assert.Equal(Reference{Path: "substructure.map", Key: "name", HasKey: true, Pos: Pos{Offset: 42, Line: 1, Column: 43}, Type: reflect.TypeOf("")}, refs[3])
+
+	assert.Equal("substructure.subsub", refs[4].Path)
+	assert.Equal("base", refs[4].Template)
+
+	// Fields in the partial are relative to the parameters passed to it and
+	// the transforms apply to the expression, not the field
+	assert.Equal("substructure.subsub.int", refs[5].Path)
+	assert.Equal("sub", refs[5].Template)
+	assert.Equal(Pos{Offset: 4, Line: 1, Column: 5}, refs[5].Pos)
+	assert.Empty(refs[5].Transforms)
+
+	assert.Equal([]string{"asTime", "json", "hex"}, tmpl.Transforms())
+
+	// The returned references are copies
+	refs[2].Transforms[0] = "x"
+	assert.Equal([]string{"asTime"}, tmpl.References()[2].Transforms)
+
+	tmpl, err = New(`{{ string }}{{ int32wrapper }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	refs = tmpl.References()
+	assert.Len(refs, 2)
+	assert.Equal(reflect.TypeOf(&wrapperspb.Int32Value{}), refs[1].Type)
+	assert.Empty(tmpl.Transforms())
+}
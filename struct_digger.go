@@ -13,6 +13,7 @@ import (
 type lookupInfo struct {
 	FieldName    string
 	FieldIndex   []int
+	Type         reflect.Type
 	AccessorFunc stringAccessFunc
 	NilValue     []byte
 	IsMap        bool
@@ -63,6 +64,17 @@ func (s *structDigger) HasField(name string) bool {
 	return false
 }
 
+// findField returns the lookup info for a field or nil if the field doesn't
+// exist.
+func (s *structDigger) findField(name string) *lookupInfo {
+	for _, v := range s.funcs {
+		if v.FieldName == name {
+			return v
+		}
+	}
+	return nil
+}
+
 // GetField returns the field value
 func (s *structDigger) GetField(name string, params interface{}) (interface{}, bool) {
 	for _, info := range s.funcs {
@@ -109,10 +121,11 @@ func (s *structDigger) GetMapValue(name string, key string, params interface{})
 	return []byte("[ unknown map ]"), false
 }
 
-func (s *structDigger) appendField(name string, index []int, f stringAccessFunc, nilValue string, ismap bool) {
+func (s *structDigger) appendField(name string, index []int, t reflect.Type, f stringAccessFunc, nilValue string, ismap bool) {
 	info := &lookupInfo{
 		FieldName:    strings.ToLower(name),
 		FieldIndex:   make([]int, 0),
+		Type:         t,
 		AccessorFunc: f,
 		NilValue:     []byte(nilValue),
 		IsMap:        ismap,
@@ -123,10 +136,11 @@ func (s *structDigger) appendField(name string, index []int, f stringAccessFunc,
 	s.funcs = append(s.funcs, info)
 }
 
-func (s *structDigger) appendParentField(name string, index []int) {
+func (s *structDigger) appendParentField(name string, index []int, t reflect.Type) {
 	info := &lookupInfo{
 		FieldName:    strings.ToLower(name),
 		FieldIndex:   make([]int, 0),
+		Type:         t,
 		AccessorFunc: nil,
 		NilValue:     []byte{},
 		IsMap:        false,
@@ -142,7 +156,7 @@ func (s *structDigger) getFields(v interface{}, name string, fieldAccess ...int)
 	val := reflect.Indirect(reflect.ValueOf(v))
 	switch val.Kind() {
 	case reflect.Struct:
-		s.appendParentField(name, fieldAccess)
+		s.appendParentField(name, fieldAccess, val.Type())
 		// It's a struct so iterate across the fields in the struct.
 		for fieldNum, field := range reflect.VisibleFields(val.Type()) {
 			if !field.IsExported() {
@@ -178,20 +192,20 @@ func (s *structDigger) getFields(v interface{}, name string, fieldAccess ...int)
 			// grpc-gateway. Since these are used exclusively as pointers in
 			// the API it's a shortcut.
 			if field.Type.String() == "*wrapperspb.StringValue" {
-				s.appendField(fieldName, fields, stringValueAccess, "", false)
+				s.appendField(fieldName, fields, field.Type, stringValueAccess, "", false)
 
 				continue
 			}
 			if field.Type.String() == "*wrapperspb.Int32Value" {
-				s.appendField(fieldName, fields, int32ValueAccess, "0", false)
+				s.appendField(fieldName, fields, field.Type, int32ValueAccess, "0", false)
 				continue
 			}
 			if field.Type.String() == "*wrapperspb.Int64Value" {
-				s.appendField(fieldName, fields, int64ValueAccess, "0", false)
+				s.appendField(fieldName, fields, field.Type, int64ValueAccess, "0", false)
 				continue
 			}
 			if field.Type.String() == "*wrapperspb.BoolValue" {
-				s.appendField(fieldName, fields, boolValueAccess, "false", false)
+				s.appendField(fieldName, fields, field.Type, boolValueAccess, "false", false)
 				continue
 			}
 			// ...and get the fields in this struct
@@ -199,47 +213,49 @@ func (s *structDigger) getFields(v interface{}, name string, fieldAccess ...int)
 		}
 
 	case reflect.String:
-		s.appendField(name, fieldAccess, stringAccess, "", false)
+		s.appendField(name, fieldAccess, val.Type(), stringAccess, "", false)
 
 	case reflect.Map:
-		s.appendField(name, fieldAccess, nil, "", true)
+		s.appendField(name, fieldAccess, val.Type(), nil, "", true)
 
 	case reflect.Bool:
-		s.appendField(name, fieldAccess, boolAccess, "false", false)
+		s.appendField(name, fieldAccess, val.Type(), boolAccess, "false", false)
 
 	case reflect.Slice:
 		switch reflect.TypeOf(v).Elem().Kind() {
 		case reflect.Uint8:
-			s.appendField(name, fieldAccess, byteSliceAccess, "", false)
+			s.appendField(name, fieldAccess, val.Type(), byteSliceAccess, "", false)
 		case reflect.Int64:
-			s.appendField(name, fieldAccess, int64SliceAccess, "", false)
+			s.appendField(name, fieldAccess, val.Type(), int64SliceAccess, "", false)
 		case reflect.Uint64:
-			s.appendField(name, fieldAccess, uint64SliceAccess, "", false)
+			s.appendField(name, fieldAccess, val.Type(), uint64SliceAccess, "", false)
 		case reflect.Int32:
-			s.appendField(name, fieldAccess, int32SliceAccess, "", false)
+			s.appendField(name, fieldAccess, val.Type(), int32SliceAccess, "", false)
 		case reflect.Uint32:
-			s.appendField(name, fieldAccess, uint32SliceAccess, "", false)
+			s.appendField(name, fieldAccess, val.Type(), uint32SliceAccess, "", false)
+		case reflect.String:
+			s.appendField(name, fieldAccess, val.Type(), stringSliceAccess, "", false)
 
 		default:
 			panic(fmt.Sprintf("Can't handle %s slices yet", reflect.TypeOf(v).Kind()))
 		}
 	case reflect.Int16:
-		s.appendField(name, fieldAccess, int16Access, "0", false)
+		s.appendField(name, fieldAccess, val.Type(), int16Access, "0", false)
 
 	case reflect.Int32:
-		s.appendField(name, fieldAccess, int32Access, "0", false)
+		s.appendField(name, fieldAccess, val.Type(), int32Access, "0", false)
 
 	case reflect.Int64:
-		s.appendField(name, fieldAccess, int64Access, "0", false)
+		s.appendField(name, fieldAccess, val.Type(), int64Access, "0", false)
 
 	case reflect.Int:
-		s.appendField(name, fieldAccess, intAccess, "0", false)
+		s.appendField(name, fieldAccess, val.Type(), intAccess, "0", false)
 
 	case reflect.Float32:
-		s.appendField(name, fieldAccess, float32Access, "0.0", false)
+		s.appendField(name, fieldAccess, val.Type(), float32Access, "0.0", false)
 
 	case reflect.Float64:
-		s.appendField(name, fieldAccess, float64Access, "0.0", false)
+		s.appendField(name, fieldAccess, val.Type(), float64Access, "0.0", false)
 
 	default:
 		panic(fmt.Sprintf("Don't know how to handle types %s\n", val.Kind()))
@@ -302,6 +318,11 @@ func uint64SliceAccess(val interface{}) string {
 
 	return "[" + strings.Join(strs, ",") + "]"
 }
+
+func stringSliceAccess(val interface{}) string {
+	return "[" + strings.Join(val.([]string), ",") + "]"
+}
+
 func intAccess(val interface{}) string {
 	return strconv.Itoa(int(val.(int)))
 }
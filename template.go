@@ -1,185 +1,258 @@
 package goplate
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"regexp"
-	"strings"
+	"reflect"
+	"sync"
 )
 
 // The entire template is build from a list of functions called in
 // sequence to assemble the template.
-type sectionFunc func(writer io.Writer, params interface{})
+type sectionFunc func(state *execState) error
+
+// execState holds the state for a single execution of the template
+type execState struct {
+	// writer is the output. It counts the bytes written for the template
+	// being executed and is shared with the partials it includes.
+	writer io.Writer
+	out    countingWriter
+	params interface{}
+	// vars holds the variable values. The slot for each variable is assigned
+	// when the template is built
+	vars []interface{}
+	// limits is set when the template is executed with ExecuteContext
+	limits *execLimits
+	// locale is used by the transforms formatting numbers and dates. The
+	// tag is the requested locale and selects the catalog messages, the
+	// locale data may be for another region.
+	localeTag string
+	locale    *Locale
+}
 
 // Template is the main templating engine
 type Template struct {
+	tree               *ListNode
 	metadata           *structDigger
 	renderingFunctions []sectionFunc
-	expressions        []string
+	variableCount      int
+	errors             []string
 	transformFunctions TransformFunctionMap
+	references         []Reference
+	transforms         []string
+	paramType          reflect.Type
+	// matcher parses rendered strings, it is nil if the template can't be
+	// matched
+	matcher  *matcher
+	matchErr error
+	// locale is the default locale for executions
+	localeTag string
+	locale    *Locale
+	// secrets signs the output in ExecuteSigned
+	secrets SecretProvider
+	// sizeHint is the size of the static text, used when allocating buffers
+	sizeHint int
+	// states holds execution states that can be reused
+	states sync.Pool
 }
 
-type state int
-
-const (
-	insideTag state = iota
-	outsideTag
-)
-
 func staticElementFunc(field string) sectionFunc {
 	b := []byte(field)
-	return func(writer io.Writer, params interface{}) {
+	return func(state *execState) error {
 		if len(field) > 0 {
-			_, _ = writer.Write(b)
+			_, err := state.writer.Write(b)
+			return err
 		}
+		return nil
 	}
 }
 
-var tagMatch *regexp.Regexp
-
-func init() {
-	tagMatch = regexp.MustCompile(`(.*)\[\"(.*)\"\]`)
+// nullElementFunc writes nothing
+func nullElementFunc(*execState) error {
+	return nil
 }
 
-// Checks if this is a map lookup and returns true/false and the tag + key names.
-func isMapLookup(field string) (bool, string, string) {
-	elems := tagMatch.FindAllStringSubmatch(field, -1)
-	if len(elems) != 1 {
-		return false, "", ""
+// chainTransforms looks up the transforms and returns a function that applies
+// them in sequence. Each transform gets the output from the previous one. The
+// function is nil if one of the transforms isn't defined.
+func chainTransforms(transforms []*TransformNode, set transformSet) (stateTransformFunc, error) {
+	var chain []stateTransformFunc
+	for _, t := range transforms {
+		f, err := set.lookup(t)
+		if err != nil || f == nil {
+			return nil, err
+		}
+		chain = append(chain, f)
 	}
-	return true, elems[0][1], elems[0][2]
+	return func(state *execState, v interface{}) (interface{}, error) {
+		var err error
+		for i, f := range chain {
+			if v, err = f(state, v); err != nil {
+				return nil, fmt.Errorf("%s at %s: %w", transforms[i].Name, transforms[i].Pos, err)
+			}
+		}
+		return v, nil
+	}, nil
 }
 
-// Checks if this field has a transform pipe set and returns the tag + names of
-// transforms. The returned names are trimmed for surrounding whitespace.
-func hasTransforms(field string) (bool, string, string) {
-	elems := strings.Split(field, "|")
-	if len(elems) < 2 {
-		return false, field, ""
+// pipelineElementFunc returns a function that writes the result of a
+// pipeline. Plain fields, optionally with transforms, are written with the
+// field's accessor while everything else is evaluated as an expression.
+func pipelineElementFunc(pipeline *PipeNode, compiler *exprCompiler, transforms transformSet) (sectionFunc, error) {
+	if field, ok := pipeline.Expr.(*FieldNode); ok && !field.HasKey && !compiler.isComputedVariable(field) {
+		return fieldElementFunc(pipeline, compiler, transforms)
 	}
-	for i, v := range elems {
-		elems[i] = strings.TrimSpace(v)
-	}
-	return true, elems[0], strings.Join(elems[1:], "|")
+	return expressionElementFunc(pipeline, compiler, transforms)
 }
 
-// tagElementFunc returns a function that will return the contents of
-// the element tag.
-func tagElementFunc(tag string, digger *structDigger, transformFunctions TransformFunctionMap) sectionFunc {
-	tagLC := strings.ToLower(tag)
-	// Check if this is a map lookup
-	istag, name, key := isMapLookup(tagLC)
-	if istag {
-		digger.KeepField(name)
-		return func(writer io.Writer, params interface{}) {
-			buf, found := digger.GetMapValue(name, key, params)
-			if !found {
-				// Write nothing
-				return
-			}
-			_, _ = writer.Write(buf)
+// fieldElementFunc returns a function that writes a field. Fields with
+// transforms are passed to the transform as is, leaf fields are formatted
+// with the field's accessor and nothing is written for structures and maps.
+func fieldElementFunc(pipeline *PipeNode, compiler *exprCompiler, transforms transformSet) (sectionFunc, error) {
+	info, get, err := compiler.resolveField(pipeline.Expr.(*FieldNode))
+	if err != nil {
+		return nullElementFunc, err
+	}
+	if len(pipeline.Transforms) > 0 {
+		transformFunc, err := chainTransforms(pipeline.Transforms, transforms)
+		if err != nil || transformFunc == nil {
+			return nullElementFunc, err
 		}
+		return func(state *execState) error {
+			val := get(state)
+			if val == nil {
+				return nil
+			}
+			out, err := transformFunc(state, val)
+			if err != nil {
+				return err
+			}
+			return writeValue(state.writer, out)
+		}, nil
+	}
+	if !info.IsLeaf || info.IsMap {
+		return nullElementFunc, nil
 	}
+	return func(state *execState) error {
+		val := get(state)
+		if val == nil {
+			_, err := state.writer.Write(info.NilValue)
+			return err
+		}
+		_, err := io.WriteString(state.writer, info.AccessorFunc(val))
+		return err
+	}, nil
+}
 
-	isTransform, name, funcs := hasTransforms(tag)
-	if isTransform {
-		// Find matching transform
-		transformFunc, ok := transformFunctions[funcs]
-		if !ok {
-			// Return null function
-			return func(io.Writer, interface{}) {}
+// expressionElementFunc returns a function that evaluates the expression and
+// writes the result.
+func expressionElementFunc(pipeline *PipeNode, compiler *exprCompiler, transforms transformSet) (sectionFunc, error) {
+	expr, err := compiler.compile(pipeline.Expr)
+	if err != nil {
+		return nullElementFunc, err
+	}
+	eval := expr.eval
+	if len(pipeline.Transforms) > 0 {
+		transformFunc, err := chainTransforms(pipeline.Transforms, transforms)
+		if err != nil || transformFunc == nil {
+			return nullElementFunc, err
 		}
-		digger.KeepField(name)
-		return func(writer io.Writer, params interface{}) {
-			val, found := digger.GetField(name, params)
-			if !found || val == nil {
-				return
+		return func(state *execState) error {
+			v, err := eval(state)
+			if err != nil {
+				return err
+			}
+			out, err := transformFunc(state, v.Interface())
+			if err != nil {
+				return err
 			}
-			_, _ = writer.Write(transformFunc(val))
+			return writeValue(state.writer, out)
+		}, nil
+	}
+	return func(state *execState) error {
+		v, err := eval(state)
+		if err != nil {
+			return err
 		}
+		_, err = io.WriteString(state.writer, v.String())
+		return err
+	}, nil
+}
+
+// compileCondition compiles the condition for an if block. The condition must
+// be a boolean expression. The condition is nil if the tag couldn't be
+// parsed, the error has already been reported in that case.
+func compileCondition(pipeline *PipeNode, compiler *exprCompiler) (evalFunc, error) {
+	never := func(*execState) (value, error) { return boolValue(false), nil }
+	if pipeline == nil {
+		return never, nil
+	}
+	if len(pipeline.Transforms) > 0 {
+		return never, errors.New("transforms can't be used in conditions")
+	}
+	expr, err := compiler.compile(pipeline.Expr)
+	if err != nil {
+		return never, err
 	}
+	if expr.kind != boolKind {
+		return never, fmt.Errorf("condition must be a bool but is %s", expr.kind)
+	}
+	return expr.eval, nil
+}
 
-	// A regular leaf node field that gets merged
-	digger.KeepField(tagLC)
-	return func(writer io.Writer, params interface{}) {
-		buf, found := digger.GetValue(tagLC, params)
-		if !found {
-			// Write nothing
-			return
+// ifElementFunc returns a function that renders one of the lists of functions
+// depending on the condition.
+func ifElementFunc(cond evalFunc, then []sectionFunc, otherwise []sectionFunc) sectionFunc {
+	return func(state *execState) error {
+		v, err := cond(state)
+		if err != nil {
+			return err
+		}
+		funcs := otherwise
+		if v.b {
+			funcs = then
 		}
-		_, _ = writer.Write(buf)
+		return executeFuncs(funcs, state)
 	}
 }
 
-// newTemplate creates a new templat
-func newTemplate(templateStr string, transforms TransformFunctionMap, params interface{}) (*Template, error) {
-	funcs := make([]sectionFunc, 0)
-
-	metadata := newStructDigger(params)
-	start := 0
-	state := outsideTag
-	prevCh := ' '
-	expressions := make([]string, 0)
-	// Scan through the template string and find strings that should be replaced
-	for i, ch := range templateStr {
-		if ch == '{' && prevCh == '{' {
-			// Add preceeding bytes to function list
-			if i > 0 {
-				funcs = append(funcs, staticElementFunc(templateStr[start:i-1]))
-			}
-			start = i + 1
-			state = insideTag
+// executeFuncs runs the functions in sequence and stops at the first error.
+// The limits are checked after each function when they are set.
+func executeFuncs(funcs []sectionFunc, state *execState) error {
+	for _, f := range funcs {
+		if err := f(state); err != nil {
+			return err
 		}
-		if ch == '}' && prevCh == '}' {
-			// End of the tag - add contents of tag to function list
-			//
-			tag := strings.TrimSpace(templateStr[start : i-1])
-			funcs = append(funcs, tagElementFunc(tag, metadata, transforms))
-			state = outsideTag
-			start = i + 1
-			expressions = append(expressions, strings.ToLower(tag))
+		if state.limits != nil {
+			if err := state.limits.check(); err != nil {
+				return err
+			}
 		}
-		prevCh = ch
 	}
-	funcs = append(funcs, staticElementFunc(templateStr[start:]))
-	// Add remainder of template to function list
-	if state == insideTag {
-		return nil, fmt.Errorf("template parse error (tag at %d isn't closed)", start)
-	}
-	metadata.RemoveUnusedFields()
-	return &Template{
-		renderingFunctions: funcs,
-		metadata:           metadata,
-		expressions:        expressions,
-		transformFunctions: transforms,
-	}, nil
+	return nil
 }
 
-// Execute writes the expanded template to the supplied io.Writer
+// Execute writes the expanded template to the supplied io.Writer. Strict
+// templates return an error if an expression fails to evaluate. The
+// execution stops at the first error from the writer and a *WriteError with
+// the number of bytes written is returned.
 func (t *Template) Execute(writer io.Writer, params interface{}) error {
-	for _, f := range t.renderingFunctions {
-		f(writer, params)
-	}
-	return nil
+	state := t.newState(writer, params)
+	state.countOutput(writer)
+	defer t.releaseState(state)
+	return executeFuncs(t.renderingFunctions, state)
 }
 
 // Validate validates the template tags
 func (t *Template) Validate() (bool, []string) {
-	errs := make([]string, 0)
-	for _, v := range t.expressions {
-		expr := strings.ToLower(v)
-		ismap, tag, _ := isMapLookup(expr)
-		if ismap {
-			expr = tag
-		}
-		istransform, tag, _ := hasTransforms(expr)
-		if istransform {
-			expr = tag
-		}
-		// TODO: Check transform functions
-		if exists := t.metadata.HasField(expr); !exists {
-			errs = append(errs, expr+" is not a known expression")
-		}
-	}
+	errs := make([]string, len(t.errors))
+	copy(errs, t.errors)
 	return len(errs) == 0, errs
 }
+
+// Tree returns the syntax tree of the template as written, ie before
+// partials and base templates are resolved.
+func (t *Template) Tree() *ListNode {
+	return t.tree
+}
@@ -12,24 +12,56 @@ type TransformFunc func(interface{}) []byte
 // TransformFunctionMap is the function transform map for the templates.
 type TransformFunctionMap map[string]TransformFunc
 
+// ValueTransformFunc is a transform returning a value for the next transform
+// in the chain. The value returned by the last transform is written as text.
+// Errors stop the execution of the template.
+type ValueTransformFunc func(interface{}) (interface{}, error)
+
+// TransformFactory creates a transform from the arguments in the template,
+// ie `{{ name | truncate 10 "..." }}`. The arguments are bool, int64, float64
+// or string values. The factory is called when the template is built so
+// invalid arguments are reported by Build.
+type TransformFactory func(args ...interface{}) (ValueTransformFunc, error)
+
+// TransformFactoryMap is the map of transforms with arguments
+type TransformFactoryMap map[string]TransformFactory
+
 // Builder is an type to build and configure template instances.
 type Builder struct {
-	TemplateString string
-	Transforms     TransformFunctionMap
-	Parameters     interface{}
+	TemplateString     string
+	Transforms         TransformFunctionMap
+	TransformFactories TransformFactoryMap
+	Parameters         interface{}
+	Strict             bool
+	Set                *Set
+	LeftDelimiter      string
+	RightDelimiter     string
+	Locale             string
+	Catalog            *Catalog
+	Secrets            SecretProvider
 }
 
-// New creates a new template builder
+// New creates a new template builder. json and hex are both in Transforms,
+// used without arguments, and in TransformFactories, used with arguments.
 func New(templateString string) *Builder {
 	ret := &Builder{
 		TemplateString: templateString,
 		Parameters:     nil,
+		LeftDelimiter:  defaultLeftDelimiter,
+		RightDelimiter: defaultRightDelimiter,
 		Transforms: TransformFunctionMap{
-			"json":   DefaultJSONTransformFunc(DefaultMarshaler()),
 			"asTime": Int64ToDateString,
-			"hex":    HexConversion,
+			"hex":    hexFunc,
 		},
+		TransformFactories: TransformFactoryMap{},
 	}
+	ret.WithTransformFactories(StringTransforms())
+	ret.WithTransformFactories(EncodingTransforms())
+	ret.WithTransformFactories(HashTransforms())
+	ret.WithTransformFactories(BinaryTransforms())
+	ret.WithTransformFactories(QueryTransforms())
+	ret.WithTransformFactories(CollectionTransforms())
+	ret.WithMarshalers(DefaultMarshalers())
 
 	return ret
 }
@@ -45,6 +77,44 @@ func (t *Builder) WithTransforms(transformMap TransformFunctionMap) *Builder {
 	return t
 }
 
+// WithTransformFactories adds transforms with arguments. Transforms in the
+// transform function map take precedence over factories with the same name
+// when no arguments are given.
+func (t *Builder) WithTransformFactories(factories TransformFactoryMap) *Builder {
+	if t.TransformFactories == nil {
+		t.TransformFactories = make(TransformFactoryMap)
+	}
+	for k, v := range factories {
+		t.TransformFactories[k] = v
+	}
+	return t
+}
+
+// WithMarshalers adds serializer transforms for the marshalers, ie
+// `{{ reading | cbor }}`. The marshalers replace transforms with the same
+// name so they can replace the default serializers.
+func (t *Builder) WithMarshalers(marshalers MarshalerMap) *Builder {
+	factories := make(TransformFactoryMap)
+	for name, m := range marshalers {
+		delete(t.Transforms, name)
+		factories[name] = marshalerTransform(m)
+		if name == "json" {
+			// The json transform has formatting options. The function is
+			// kept for compatibility and used without arguments.
+			t.Transforms[name] = DefaultJSONTransformFunc(m)
+			factories[name] = jsonTransform(m)
+		}
+	}
+	return t.WithTransformFactories(factories)
+}
+
+// WithSecrets sets the secret provider for the hmac transform and
+// Template.ExecuteSigned. The provider is used when the template is built.
+func (t *Builder) WithSecrets(secrets SecretProvider) *Builder {
+	t.Secrets = secrets
+	return t
+}
+
 // WithParameters sets the parameter type used for the template. When the structure
 // is built it will use this parameter struct to validate the template
 func (t *Builder) WithParameters(params interface{}) *Builder {
@@ -52,17 +122,97 @@ func (t *Builder) WithParameters(params interface{}) *Builder {
 	return t
 }
 
-func (t *Builder) WithJSONMarshaler(marshaler JSONMarshaler) *Builder {
-	t.Transforms["json"] = DefaultJSONTransformFunc(marshaler)
+// WithStrictMode makes arithmetic overflows and division by zero in
+// expressions return an error when the template is executed. Non-strict
+// templates wrap integers around and return 0 when an integer is divided by
+// zero.
+func (t *Builder) WithStrictMode() *Builder {
+	t.Strict = true
 	return t
 }
 
+// WithDelimiters sets the delimiters for tags. The default delimiters are
+// "{{" and "}}". Trim markers, comments, escapes and raw blocks use the same
+// delimiters, ie "<%- x -%>", "<%/* comment */%>" and "\\<%". The delimiters
+// also apply to partials and base templates included from the set.
+func (t *Builder) WithDelimiters(left string, right string) *Builder {
+	t.LeftDelimiter = left
+	t.RightDelimiter = right
+	return t
+}
+
+// delimiters returns the tag delimiters, using the defaults if they aren't set
+func (t *Builder) delimiters() (string, string) {
+	left, right := t.LeftDelimiter, t.RightDelimiter
+	if left == "" {
+		left = defaultLeftDelimiter
+	}
+	if right == "" {
+		right = defaultRightDelimiter
+	}
+	return left, right
+}
+
+// Parse parses the template string with the builder's delimiters and returns
+// the syntax tree. See the Parse function for details.
+func (t *Builder) Parse() (*ListNode, error) {
+	left, right := t.delimiters()
+	return parse(t.TemplateString, left, right)
+}
+
+// WithLocale sets the locale used to format numbers, currencies and dates,
+// ie "de-DE". The default locale is "en-US". The locale can be changed for an
+// execution with ExecuteOptions.
+func (t *Builder) WithLocale(tag string) *Builder {
+	t.Locale = tag
+	return t
+}
+
+// WithCatalog sets the message catalog for `{{ t "key" args }}`. The
+// messages are looked up in the locale of the execution.
+func (t *Builder) WithCatalog(catalog *Catalog) *Builder {
+	t.Catalog = catalog
+	return t
+}
+
+// locale returns the builder's locale tag and the locale data for it, using
+// the default if it isn't set
+func (t *Builder) locale() (string, *Locale, error) {
+	tag := t.Locale
+	if tag == "" {
+		tag = DefaultLocale
+	}
+	l, err := LookupLocale(tag)
+	return tag, l, err
+}
+
+// WithSet sets the set of partials that can be included in the template
+func (t *Builder) WithSet(set *Set) *Builder {
+	t.Set = set
+	return t
+}
+
+// WithPartial adds a named partial to the builder's set. A new set is
+// created if the builder doesn't have one.
+func (t *Builder) WithPartial(name string, templateString string) *Builder {
+	if t.Set == nil {
+		t.Set = NewSet()
+	}
+	t.Set.Add(name, templateString)
+	return t
+}
+
+// WithJSONMarshaler sets the marshaler for the json transform
+func (t *Builder) WithJSONMarshaler(marshaler JSONMarshaler) *Builder {
+	return t.WithMarshalers(MarshalerMap{"json": marshaler})
+}
+
 // Build builds and validates the template
 func (t *Builder) Build() (*Template, error) {
 	if t.TemplateString == "" || t.Parameters == nil {
 		return nil, errors.New("missing parameters")
 	}
-	template, err := newTemplate(t.TemplateString, t.Transforms, t.Parameters)
+	template, err := newTemplate(t)
 	if err != nil {
 		return nil, err
 	}
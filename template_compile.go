@@ -0,0 +1,261 @@
+package goplate
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// templateCompiler compiles the syntax tree into rendering functions.
+type templateCompiler struct {
+	ctx        *buildContext
+	params     interface{}
+	digger     *structDigger
+	compiler   *exprCompiler
+	transforms transformSet
+	errs       []string
+	// overrides are the sections defined in templates extending this one.
+	// The active overrides are the ones being compiled.
+	overrides       map[string]override
+	activeOverrides map[string]bool
+	// staticSize is the size of the static text compiled so far
+	staticSize int
+}
+
+// override is a section replacing a block and the name of the template with
+// the definition
+type override struct {
+	list     *ListNode
+	template string
+}
+
+// newTemplate creates a new template from the builder's settings
+func newTemplate(b *Builder) (*Template, error) {
+	return compileTemplate(&buildContext{builder: b}, b.TemplateString, b.Parameters)
+}
+
+// compileTemplate compiles a template string. This is used both for the
+// template itself and the partials it includes.
+func compileTemplate(ctx *buildContext, templateStr string, params interface{}) (*Template, error) {
+	left, right := ctx.builder.delimiters()
+	tree, errs, err := parseTemplate(templateStr, left, right)
+	if err != nil {
+		return nil, err
+	}
+	localeTag, locale, err := ctx.builder.locale()
+	if err != nil {
+		return nil, err
+	}
+	metadata := newStructDigger(params)
+	tc := &templateCompiler{
+		ctx:             ctx,
+		params:          params,
+		digger:          metadata,
+		compiler:        newExprCompiler(metadata, ctx.builder.Strict, ctx.builder.Catalog),
+		transforms:      transformSet{funcs: ctx.builder.Transforms, factories: ctx.builder.TransformFactories, locale: localeTransforms(), secrets: ctx.builder.Secrets},
+		errs:            errs,
+		overrides:       make(map[string]override),
+		activeOverrides: make(map[string]bool),
+	}
+	root, name, err := tc.resolveInheritance(tree, "")
+	if err != nil {
+		return nil, err
+	}
+	tc.compiler.template = name
+	funcs, err := tc.compileList(root)
+	if err != nil {
+		return nil, err
+	}
+	metadata.RemoveUnusedFields()
+	matcher, matchErr := newMatcher(tree, metadata)
+	return &Template{
+		tree:               tree,
+		renderingFunctions: funcs,
+		variableCount:      tc.compiler.slots,
+		metadata:           metadata,
+		errors:             tc.errs,
+		transformFunctions: tc.transforms.funcs,
+		references:         tc.compiler.references,
+		transforms:         tc.compiler.usedTransforms,
+		paramType:          reflect.TypeOf(params),
+		matcher:            matcher,
+		matchErr:           matchErr,
+		localeTag:          localeTag,
+		locale:             locale,
+		secrets:            ctx.builder.Secrets,
+		sizeHint:           tc.staticSize,
+	}, nil
+}
+
+// addError adds a validation error for a node
+func (tc *templateCompiler) addError(node Node, err error) {
+	tc.errs = append(tc.errs, fmt.Sprintf("%s: %v", node.Position(), err))
+}
+
+// compileList compiles the nodes in a list. Errors in expressions are added
+// to the validation errors, misplaced definitions are returned as errors.
+func (tc *templateCompiler) compileList(list *ListNode) ([]sectionFunc, error) {
+	compiler := tc.compiler
+	funcs := make([]sectionFunc, 0)
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *TextNode:
+			funcs = append(funcs, staticElementFunc(n.Text))
+			tc.staticSize += len(n.Text)
+
+		case *CommentNode:
+			// Comments render nothing
+
+		case *ActionNode:
+			start := len(compiler.references)
+			f, err := pipelineElementFunc(n.Pipe, compiler, tc.transforms)
+			if err != nil {
+				tc.addError(n, err)
+			}
+			compiler.addTransforms(n.Pipe, start)
+			funcs = append(funcs, f)
+
+		case *AssignNode:
+			assign, err := compiler.compileAssignment(n.Variable, n.Pipe)
+			if err != nil {
+				tc.addError(n, err)
+				break
+			}
+			funcs = append(funcs, assign)
+
+		case *IncludeNode:
+			f, err := tc.ctx.includeElementFunc(n, compiler, tc.params)
+			if err != nil {
+				tc.addError(n, err)
+			}
+			funcs = append(funcs, f)
+
+		case *IfNode:
+			cond, err := compileCondition(n.Cond, compiler)
+			if err != nil {
+				tc.addError(n, err)
+			}
+			then, err := tc.compileSection(n.List)
+			if err != nil {
+				return nil, err
+			}
+			var otherwise []sectionFunc
+			if n.ElseList != nil {
+				if otherwise, err = tc.compileSection(n.ElseList); err != nil {
+					return nil, err
+				}
+			}
+			funcs = append(funcs, ifElementFunc(cond, then, otherwise))
+
+		case *BlockNode:
+			blockFuncs, err := tc.compileBlock(n)
+			if err != nil {
+				return nil, err
+			}
+			// Blocks are flattened into the surrounding list
+			funcs = append(funcs, blockFuncs...)
+
+		case *DefineNode:
+			return nil, parseError("unexpected define at %s", n.Pos)
+
+		case *ExtendsNode:
+			return nil, parseError("unexpected extends at %s", n.Pos)
+		}
+	}
+	return funcs, nil
+}
+
+// compileSection compiles the contents of a section in a new variable scope
+func (tc *templateCompiler) compileSection(list *ListNode) ([]sectionFunc, error) {
+	tc.compiler.pushScope()
+	defer tc.compiler.popScope()
+	return tc.compileList(list)
+}
+
+// compileBlock compiles the contents of a block. If a template extending this
+// one defines the block the definition is compiled in place of the default
+// contents. The definition can't override itself.
+func (tc *templateCompiler) compileBlock(n *BlockNode) ([]sectionFunc, error) {
+	override, ok := tc.overrides[n.Name]
+	if !ok || tc.activeOverrides[n.Name] {
+		return tc.compileSection(n.List)
+	}
+	tc.activeOverrides[n.Name] = true
+	defer delete(tc.activeOverrides, n.Name)
+	template := tc.compiler.template
+	tc.compiler.template = override.template
+	defer func() { tc.compiler.template = template }()
+	return tc.compileSection(override.list)
+}
+
+// resolveInheritance checks if the template extends another template. If it
+// does the defined sections are added to the overrides and the tree and name
+// of the base template is returned. Templates extending other templates can
+// only contain definitions.
+func (tc *templateCompiler) resolveInheritance(tree *ListNode, name string) (*ListNode, string, error) {
+	var extends *ExtendsNode
+	var rest []Node
+	for i, node := range tree.Nodes {
+		if isBlank(node) {
+			continue
+		}
+		extends, _ = node.(*ExtendsNode)
+		rest = tree.Nodes[i+1:]
+		break
+	}
+	if extends == nil {
+		return tree, name, nil
+	}
+
+	defines := make(map[string]*ListNode)
+	for _, node := range rest {
+		if isBlank(node) {
+			continue
+		}
+		define, ok := node.(*DefineNode)
+		switch {
+		case !ok:
+			if _, isText := node.(*TextNode); isText {
+				return nil, "", parseError("text outside define at %s", node.Position())
+			}
+			return nil, "", parseError("expected define at %s", node.Position())
+		case defines[define.Name] != nil:
+			return nil, "", parseError("%q at %s is already defined", define.Name, define.Pos)
+		}
+		defines[define.Name] = define.List
+	}
+	// Definitions in the most derived template wins
+	for block, section := range defines {
+		if _, exists := tc.overrides[block]; !exists {
+			tc.overrides[block] = override{list: section, template: name}
+		}
+	}
+
+	base, err := tc.ctx.lookupTemplate(extends.Name)
+	if err != nil {
+		return nil, "", err
+	}
+	tc.ctx.stack = append(tc.ctx.stack, extends.Name)
+	defer func() { tc.ctx.stack = tc.ctx.stack[:len(tc.ctx.stack)-1] }()
+	left, right := tc.ctx.builder.delimiters()
+	baseTree, errs, err := parseTemplate(base, left, right)
+	if err != nil {
+		return nil, "", fmt.Errorf("template %q: %v", extends.Name, err)
+	}
+	for _, e := range errs {
+		tc.errs = append(tc.errs, fmt.Sprintf("template %q: %s", extends.Name, e))
+	}
+	return tc.resolveInheritance(baseTree, extends.Name)
+}
+
+// isBlank checks if the node is whitespace or a comment
+func isBlank(node Node) bool {
+	switch n := node.(type) {
+	case *TextNode:
+		return strings.TrimSpace(n.Text) == ""
+	case *CommentNode:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package goplate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Set is a collection of named partial templates. The partials are included
+// in other templates with {{ include "name" }} which renders the partial with
+// the same parameters or {{ template "name" field }} which renders the
+// partial with the field as the parameters. Templates in the set can also be
+// used as base templates with {{ extends "name" }}. A set can be shared
+// between builders.
+type Set struct {
+	partials map[string]string
+}
+
+// NewSet creates a new empty set of partials
+func NewSet() *Set {
+	return &Set{partials: make(map[string]string)}
+}
+
+// Add adds a partial to the set, replacing any existing partial with the same
+// name. The partial is parsed and validated when a template that includes it
+// is built since the parameter type depends on the including template.
+func (s *Set) Add(name string, templateString string) *Set {
+	s.partials[name] = templateString
+	return s
+}
+
+type partialKey struct {
+	name      string
+	paramType reflect.Type
+}
+
+// buildContext is shared between a template and the partials it includes
+// while it is built.
+type buildContext struct {
+	builder *Builder
+	// stack is the partials currently being built, used to detect cycles
+	stack    []string
+	partials map[partialKey]*Template
+}
+
+// lookupTemplate returns the named template from the set. Templates that are
+// being built can't be used again since that would be a cycle.
+func (c *buildContext) lookupTemplate(name string) (string, error) {
+	for _, n := range c.stack {
+		if n == name {
+			return "", fmt.Errorf("template cycle %s -> %s", strings.Join(c.stack, " -> "), name)
+		}
+	}
+	var templateString string
+	found := false
+	if c.builder.Set != nil {
+		templateString, found = c.builder.Set.partials[name]
+	}
+	if !found {
+		return "", fmt.Errorf("template %q is not defined", name)
+	}
+	return templateString, nil
+}
+
+// partial compiles the named partial with the parameter type. Partials are
+// only compiled once per parameter type.
+func (c *buildContext) partial(name string, params interface{}) (*Template, error) {
+	templateString, err := c.lookupTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	key := partialKey{name: name, paramType: reflect.TypeOf(params)}
+	if t, ok := c.partials[key]; ok {
+		return t, nil
+	}
+
+	c.stack = append(c.stack, name)
+	defer func() { c.stack = c.stack[:len(c.stack)-1] }()
+	t, err := compileTemplate(c, templateString, params)
+	if err != nil {
+		return nil, fmt.Errorf("partial %q: %v", name, err)
+	}
+	if ok, errs := t.Validate(); !ok {
+		return nil, fmt.Errorf("partial %q: %s", name, strings.Join(errs, ","))
+	}
+	if c.partials == nil {
+		c.partials = make(map[partialKey]*Template)
+	}
+	c.partials[key] = t
+	return t, nil
+}
+
+// includeElementFunc returns a function that renders a partial. The partial
+// is validated against the type of the parameters passed to it. Nothing is
+// written if the parameters are nil.
+func (c *buildContext) includeElementFunc(n *IncludeNode, compiler *exprCompiler, rootParams interface{}) (sectionFunc, error) {
+	params := rootParams
+	get := func(state *execState) interface{} { return state.params }
+	prefix := ""
+
+	if n.Pipe != nil {
+		field, ok := n.Pipe.Expr.(*FieldNode)
+		if !ok || field.HasKey || len(n.Pipe.Transforms) > 0 || compiler.isComputedVariable(field) {
+			return nullElementFunc, errors.New("partial parameters must be a field")
+		}
+		info, getField, err := compiler.resolveField(field)
+		if err != nil {
+			return nullElementFunc, err
+		}
+		if info.IsLeaf {
+			return nullElementFunc, fmt.Errorf("%s is not a structure", field)
+		}
+		params = reflect.New(info.Type).Interface()
+		get = getField
+		prefix = info.FieldName + "."
+	}
+
+	partial, err := c.partial(n.Name, params)
+	if err != nil {
+		return nullElementFunc, err
+	}
+	// The fields in the partial are relative to the parameters passed to it
+	for _, ref := range partial.references {
+		ref.Path = prefix + ref.Path
+		if ref.Template == "" {
+			ref.Template = n.Name
+		}
+		compiler.references = append(compiler.references, ref)
+	}
+	for _, name := range partial.transforms {
+		compiler.useTransform(name)
+	}
+	return func(state *execState) error {
+		p := get(state)
+		if p == nil {
+			return nil
+		}
+		return partial.executePartial(state, p)
+	}, nil
+}
@@ -0,0 +1,137 @@
+package goplate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartials(t *testing.T) {
+	assert := require.New(t)
+
+	set := NewSet().
+		Add("sub", `[{{ int }}/{{ float64 }}]`).
+		Add("root", `<{{ int32 }}{{ template "sub" substructure.subsub }}>`)
+
+	tmpl, err := New(`{{ include "root" }}:{{ $s := substructure }}{{ template "sub" $s.subsub }}`).
+		WithParameters(&testStructure{}).
+		WithSet(set).
+		Build()
+	assert.NoError(err)
+
+	params := &testStructure{
+		Int32: 32,
+		Substructure: &testSubStructure{
+			SubSub: &testSubSubStructure{Int: 1, Float64: 2},
+		},
+	}
+	buf := &bytes.Buffer{}
+	assert.NoError(tmpl.Execute(buf, params))
+	assert.Equal("<32[1/2.0000000000]>:[1/2.0000000000]", buf.String())
+
+	// Nil parameters renders nothing
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, &testStructure{Int32: 1}))
+	assert.Equal("<1>:", buf.String())
+
+	// Partials can be added directly to the builder
+	tmpl, err = New(`{{ template "p" substructure }}`).
+		WithParameters(&testStructure{}).
+		WithPartial("p", `{{ if bool }}yes{{ else }}no{{ end }}`).
+		Build()
+	assert.NoError(err)
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, params))
+	assert.Equal("no", buf.String())
+}
+
+func TestPartialValidation(t *testing.T) {
+	assert := require.New(t)
+
+	set := NewSet().
+		Add("sub", `{{ int }}`).
+		Add("a", `{{ include "b" }}`).
+		Add("b", `{{ include "a" }}`).
+		Add("self", `{{ template "self" substructure }}`).
+		Add("broken", `{{ if int32 }}`)
+
+	for _, invalid := range []string{
+		`{{ include "unknown" }}`,
+		`{{ include "sub" }}`,
+		`{{ template "sub" substructure }}`,
+		`{{ template "sub" int32 }}`,
+		`{{ template "sub" substructure.subsub | json }}`,
+		`{{ template "sub" int32 + 1 }}`,
+		`{{ include "a" }}`,
+		`{{ include "self" }}`,
+		`{{ include "broken" }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).WithSet(set).Build()
+		assert.Error(err, invalid)
+	}
+
+	// No set
+	_, err := New(`{{ include "sub" }}`).WithParameters(&testStructure{}).Build()
+	assert.Error(err)
+}
+
+func TestTemplateInheritance(t *testing.T) {
+	assert := require.New(t)
+
+	set := NewSet().
+		Add("base", `<{{ block "header" }}default header{{ end }}|{{ block "body" }}{{ $v := int32 }}{{ $v }}{{ end }}>`).
+		Add("middle", `{{ extends "base" }}{{ define "header" }}middle header{{ end }}{{ define "body" }}middle body{{ end }}`)
+
+	params := &testStructure{Int32: 32, String: "str"}
+
+	// Blocks render the default content when used directly
+	tmpl, err := New(`{{ include "base" }}`).WithParameters(&testStructure{}).WithSet(set).Build()
+	assert.NoError(err)
+	buf := &bytes.Buffer{}
+	assert.NoError(tmpl.Execute(buf, params))
+	assert.Equal("<default header|32>", buf.String())
+
+	tmpl, err = New(`
+		{{ extends "base" }}
+		{{ define "body" }}{{ if int32 > 1 }}{{ string }}{{ end }}{{ end }}
+	`).WithParameters(&testStructure{}).WithSet(set).Build()
+	assert.NoError(err)
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, params))
+	assert.Equal("<default header|str>", buf.String())
+
+	// Blocks are flattened into the rendering functions
+	assert.Len(tmpl.renderingFunctions, 5)
+
+	// The most derived definition is used
+	tmpl, err = New(`{{ extends "middle" }}{{ define "body" }}child body{{ end }}`).WithParameters(&testStructure{}).WithSet(set).Build()
+	assert.NoError(err)
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, params))
+	assert.Equal("<middle header|child body>", buf.String())
+
+	// Definitions can use blocks with the same name
+	tmpl, err = New(`{{ extends "base" }}{{ define "header" }}[{{ block "header" }}inner{{ end }}]{{ end }}`).WithParameters(&testStructure{}).WithSet(set).Build()
+	assert.NoError(err)
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, params))
+	assert.Equal("<[inner]|32>", buf.String())
+
+	set.Add("loop", `{{ extends "loop" }}`)
+	for _, invalid := range []string{
+		`{{ extends "unknown" }}`,
+		`{{ extends "loop" }}`,
+		`{{ extends "base" }}text`,
+		`{{ extends "base" }}{{ int32 }}`,
+		`{{ extends "base" }}{{ define "body" }}`,
+		`{{ extends "base" }}{{ define "body" }}{{ end }}{{ define "body" }}{{ end }}`,
+		`{{ extends "base" }}{{ define "body" }}{{ unknown }}{{ end }}`,
+		`{{ define "body" }}{{ end }}`,
+		`{{ block "body" }}`,
+		`{{ int32 }}{{ extends "base" }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).WithSet(set).Build()
+		assert.Error(err, invalid)
+	}
+}
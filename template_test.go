@@ -44,21 +44,6 @@ func TestTemplateRendering(t *testing.T) {
 	assert.Equal(":::", buf.String())
 }
 
-func TestTransformCheck(t *testing.T) {
-	assert := require.New(t)
-
-	found, elem, transforms := hasTransforms("something")
-	assert.False(found)
-	assert.Equal("something", elem)
-	assert.Equal("", transforms)
-
-	found, elem, transforms = hasTransforms("something | other")
-	assert.True(found)
-	assert.Equal("something", elem)
-	assert.Equal("other", transforms)
-
-}
-
 // Test payload rendering. This is a bit different from the string-type replacements for the topics
 // elsewhere. The objects uses the default marshaller.
 func TestTransformFunctions(t *testing.T) {
@@ -153,18 +138,37 @@ func TestCustomTransforms(t *testing.T) {
 	assert.Equal(expected, buf.Bytes())
 }
 
-func TestMapCheck(t *testing.T) {
+func TestReplaceBuiltinTransforms(t *testing.T) {
 	assert := require.New(t)
 
-	found, name, key := isMapLookup(`some.map["name"]`)
-	assert.True(found)
-	assert.Equal("some.map", name)
-	assert.Equal("name", key)
+	// json and hex are functions without arguments and factories with
+	// arguments
+	builder := New(`{{ string | json }} {{ string | hex }} {{ string | hex "upper" }}`).WithParameters(&testStructure{})
+	assert.Equal([]byte(`"a"`), builder.Transforms["json"]("a"))
+	assert.Equal([]byte("61"), builder.Transforms["hex"]("a"))
+	assert.NotNil(builder.TransformFactories["json"])
+	assert.NotNil(builder.TransformFactories["hex"])
+
+	// Functions with the same names replace them without arguments
+	tmpl, err := builder.WithTransforms(TransformFunctionMap{
+		"json": DefaultJSONTransformFunc(DefaultMarshaler()),
+		"hex":  HexConversion,
+	}).Build()
+	assert.NoError(err)
+	s, err := tmpl.ExecuteString(&testStructure{String: "a"})
+	assert.NoError(err)
+	assert.Equal(`"a"  61`, s)
+
+	// A json marshaler replaces the function too
+	builder = New(`{{ string | json }}`).
+		WithParameters(&testStructure{}).
+		WithJSONMarshaler(MarshalerFunc(func(interface{}) ([]byte, error) { return []byte("x"), nil }))
+	assert.Equal([]byte("x"), builder.Transforms["json"]("a"))
 }
 
 func TestTemplateValidation(t *testing.T) {
 	assert := require.New(t)
-	tmpl, err := newTemplate(`{{int32}} {{substructure.float64}} {{mumbojump{}foo}}`, make(TransformFunctionMap), &testStructure{})
+	tmpl, err := newTemplate(&Builder{TemplateString: `{{int32}} {{substructure.float64}} {{mumbojump{}foo}}`, Transforms: make(TransformFunctionMap), Parameters: &testStructure{}})
 	assert.NoError(err)
 	assert.NotNil(tmpl)
 
@@ -173,7 +177,7 @@ func TestTemplateValidation(t *testing.T) {
 	assert.False(ok)
 	assert.Len(errors, 2)
 
-	tmpl, err = newTemplate(`{{int32}} {{substructure.bool}} {{substructure.map["name"]}}`, make(TransformFunctionMap), &testStructure{})
+	tmpl, err = newTemplate(&Builder{TemplateString: `{{int32}} {{substructure.bool}} {{substructure.map["name"]}}`, Transforms: make(TransformFunctionMap), Parameters: &testStructure{}})
 	assert.NoError(err)
 	assert.NotNil(tmpl)
 	ok, errors = tmpl.Validate()
@@ -260,3 +264,118 @@ func BenchmarkCustomTemplateTopicStatic(b *testing.B) {
 		_ = tmpl.Execute(io.Discard, params)
 	}
 }
+
+func TestWhitespaceTrimming(t *testing.T) {
+	assert := require.New(t)
+
+	tmpl, err := New(`
+		<
+		{{- if int32 > 1 -}}
+			{{ int32 }} {{- " " -}}   ,
+		{{- else -}}
+			small
+		{{- end }}
+		{{- -3 }}>`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(tmpl.Execute(buf, &testStructure{Int32: 2}))
+	assert.Equal("\n\t\t<2 ,-3>", buf.String())
+
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, &testStructure{Int32: 1}))
+	assert.Equal("\n\t\t<small-3>", buf.String())
+
+	// The marker must be followed by whitespace
+	tmpl, err = New(`a {{-int32}} b {{int32 -1}} c`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	buf.Reset()
+	assert.NoError(tmpl.Execute(buf, &testStructure{Int32: 2}))
+	assert.Equal("a -2 b 1 c", buf.String())
+}
+
+func TestEscapesAndComments(t *testing.T) {
+	assert := require.New(t)
+
+	tests := map[string]string{
+		`\{{ int32 }} is {{ int32 }}`:                             "{{ int32 }} is 1",
+		`{"a":{"b":{{ int32 }}}}`:                                 `{"a":{"b":1}}`,
+		`{{ "{{" }}literal}}`:                                     "{{literal}}",
+		`a{{/* a comment with }} and {{ */}}b`:                    "ab",
+		"a {{- /* trimmed\ncomment */ -}} b":                      "ab",
+		`{{# raw }}{{ int32 }} {{ if }}{{ endraw }}{{# endraw }}`: "{{ int32 }} {{ if }}{{ endraw }}",
+		"<{{- # raw -}} {{ x }} {{- # endraw -}} >{{ int32 }}":    "<{{ x }}>1",
+		`{{# raw }}{{# endraw }}{{ int32 }}{{#raw}}{{#endraw}}`:   "1",
+		`x {{ int32 -}} {{# raw }} kept {{# endraw }}`:            "x 1 kept ",
+		`\\{{ int32 }} \\\{{ int32 }}`:                            `\1 \{{ int32 }}`,
+		`a\\b\\{{ int32 }}`:                                       `a\\b\1`,
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		buf := &bytes.Buffer{}
+		assert.NoError(tmpl.Execute(buf, &testStructure{Int32: 1}))
+		assert.Equal(expected, buf.String(), tmplStr)
+	}
+
+	for _, invalid := range []string{
+		`{{/* not closed }}`,
+		`{{/* not closed */ x }}`,
+		`{{# raw }} not closed`,
+		`{{# raw`,
+		`{{# endraw }}`,
+		`{{# other }}{{# endraw }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+}
+
+func TestRawField(t *testing.T) {
+	assert := require.New(t)
+
+	type params struct {
+		Raw    []byte
+		Endraw int
+	}
+	// raw and endraw without the raw marker are fields
+	tmpl, err := New(`{{ raw }}/{{ endraw }}`).WithParameters(&params{}).Build()
+	assert.NoError(err)
+	s, err := tmpl.ExecuteString(&params{Raw: []byte{1, 2}, Endraw: 3})
+	assert.NoError(err)
+	assert.Equal("AQI=/3", s)
+}
+
+func TestCustomDelimiters(t *testing.T) {
+	assert := require.New(t)
+
+	tests := map[string][]string{
+		`{{ mustache }} ${ int32 }/${substructure.map["name"]}`:            {"${", "}", `{{ mustache }} 1/x`},
+		`<%- if int32 > 0 -%> yes <%- end %> \<% <%/* comment */%>{{ x }}`: {"<%", "%>", `yes <% {{ x }}`},
+		`[[# raw ]][[ int32 ]][[# endraw ]] [[ int32 * 2 ]] \\[[ int32 ]]`: {"[[", "]]", `[[ int32 ]] 2 \1`},
+	}
+	for tmplStr, v := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).WithDelimiters(v[0], v[1]).Build()
+		assert.NoError(err, tmplStr)
+		buf := &bytes.Buffer{}
+		assert.NoError(tmpl.Execute(buf, &testStructure{
+			Int32:        1,
+			Substructure: &testSubStructure{Map: map[string]string{"name": "x"}},
+		}))
+		assert.Equal(v[2], buf.String(), tmplStr)
+	}
+
+	// Partials use the same delimiters
+	tmpl, err := New(`<% include "p" %>`).
+		WithParameters(&testStructure{}).
+		WithDelimiters("<%", "%>").
+		WithPartial("p", `<% int32 %>`).
+		Build()
+	assert.NoError(err)
+	buf := &bytes.Buffer{}
+	assert.NoError(tmpl.Execute(buf, &testStructure{Int32: 1}))
+	assert.Equal("1", buf.String())
+
+	_, err = New(`<% int32`).WithParameters(&testStructure{}).WithDelimiters("<%", "%>").Build()
+	assert.Error(err)
+}
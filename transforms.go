@@ -2,11 +2,150 @@ package goplate
 
 import (
 	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
+// transformSet is the transforms available to a template
+type transformSet struct {
+	funcs     TransformFunctionMap
+	factories TransformFactoryMap
+	locale    map[string]localeTransformFactory
+	// secrets is the provider for the built-in hmac transform
+	secrets SecretProvider
+}
+
+// stateTransformFunc is a transform in a template. The execution state has
+// the settings for the execution, ie the locale.
+type stateTransformFunc func(state *execState, v interface{}) (interface{}, error)
+
+// lookup returns the transform for the node. The transform is nil if it
+// isn't defined. A function is used when the transform has no arguments or
+// there is no factory with the same name, so the json and hex functions in
+// Builder.Transforms work alongside the factories taking arguments.
+func (s transformSet) lookup(n *TransformNode) (stateTransformFunc, error) {
+	if f, ok := s.funcs[n.Name]; ok && (len(n.Args) == 0 || s.factories[n.Name] == nil) {
+		if len(n.Args) > 0 {
+			return nil, fmt.Errorf("transform %s at %s doesn't take arguments", n.Name, n.Pos)
+		}
+		return func(_ *execState, v interface{}) (interface{}, error) { return f(v), nil }, nil
+	}
+	args := make([]interface{}, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = arg.Value
+	}
+	if factory, ok := s.factories[n.Name]; ok {
+		f, err := factory(args...)
+		if err == errNoSecretProvider && s.secrets != nil {
+			f, err = hmacTransform(s.secrets)(args...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("transform %s at %s: %v", n.Name, n.Pos, err)
+		}
+		return func(_ *execState, v interface{}) (interface{}, error) { return f(v) }, nil
+	}
+	if factory, ok := s.locale[n.Name]; ok {
+		f, err := factory(args...)
+		if err != nil {
+			return nil, fmt.Errorf("transform %s at %s: %v", n.Name, n.Pos, err)
+		}
+		return func(state *execState, v interface{}) (interface{}, error) { return f(state.locale, v) }, nil
+	}
+	return nil, nil
+}
+
+// writeValue writes the output of a transform. Byte slices and strings are
+// written as is and other values are formatted with formatValue.
+func writeValue(w io.Writer, v interface{}) error {
+	var err error
+	switch s := v.(type) {
+	case nil:
+	case []byte:
+		_, err = w.Write(s)
+	case string:
+		_, err = io.WriteString(w, s)
+	default:
+		_, err = io.WriteString(w, formatValue(v))
+	}
+	return err
+}
+
+// formatValue formats a value as text. Floats are formatted like in
+// expressions. Values without a text form are empty.
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	s, _ := textValue(v)
+	return s
+}
+
+// textValue converts a value to text. Byte slices are used as is since they
+// are the output from other transforms or binary payloads, floats are
+// formatted like rendered float fields, other numbers and bools like in
+// expressions, wrapper types are formatted as the wrapped value and slices as
+// a comma separated list in brackets. nil, maps and structures have no text
+// form.
+func textValue(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return val, true
+	case []byte:
+		return string(val), true
+	case bool:
+		return strconv.FormatBool(val), true
+	case int:
+		return strconv.Itoa(val), true
+	case int16:
+		return strconv.FormatInt(int64(val), 10), true
+	case int32:
+		return strconv.FormatInt(int64(val), 10), true
+	case int64:
+		return strconv.FormatInt(val, 10), true
+	case uint32:
+		return strconv.FormatUint(uint64(val), 10), true
+	case uint64:
+		return strconv.FormatUint(val, 10), true
+	case float32:
+		return float32Access(val), true
+	case float64:
+		return float64Access(val), true
+	case *wrapperspb.StringValue:
+		return val.GetValue(), true
+	case *wrapperspb.Int32Value:
+		return strconv.FormatInt(int64(val.GetValue()), 10), true
+	case *wrapperspb.Int64Value:
+		return strconv.FormatInt(val.GetValue(), 10), true
+	case *wrapperspb.BoolValue:
+		return strconv.FormatBool(val.GetValue()), true
+	case fmt.Stringer:
+		return val.String(), true
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		elems := make([]string, rv.Len())
+		for i := range elems {
+			elems[i] = formatValue(rv.Index(i).Interface())
+		}
+		return "[" + strings.Join(elems, ",") + "]", true
+	case reflect.Map, reflect.Struct, reflect.Invalid:
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
 // DefaultJSONTransformFunc is the default JSON transform function
 func DefaultJSONTransformFunc(marshaler JSONMarshaler) TransformFunc {
 	return func(obj interface{}) []byte {
@@ -0,0 +1,266 @@
+package goplate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// BinaryTransforms returns the transforms decoding binary payloads. They are
+// registered by default by New.
+//
+// The number transforms read a value at a byte offset of the payload, ie
+// `{{ payload | uint16 2 "le" }}`. The byte order is "be" (the default) or
+// "le". Unsigned values are uint64, signed values int64 and floats float32 or
+// float64 so they can be transformed further. The cborDecode and msgpackDecode
+// transforms decode the whole payload into maps and slices which can be
+// accessed with the get transform or rendered with json.
+//
+// A payload too short for the offset is an error when the template is
+// executed.
+func BinaryTransforms() TransformFactoryMap {
+	return TransformFactoryMap{
+		"uint8":         intTransform(1, false),
+		"uint16":        intTransform(2, false),
+		"uint32":        intTransform(4, false),
+		"uint64":        intTransform(8, false),
+		"int8":          intTransform(1, true),
+		"int16":         intTransform(2, true),
+		"int32":         intTransform(4, true),
+		"int64":         intTransform(8, true),
+		"float32":       floatTransform(4),
+		"float64":       floatTransform(8),
+		"bits":          bitsTransform,
+		"bcd":           bcdTransform,
+		"cborDecode":    bytesCodec(decodeCBOR),
+		"msgpackDecode": bytesCodec(decodeMsgpack),
+		"get":           getTransform,
+	}
+}
+
+// byteOrderArg returns the byte order for the argument
+func byteOrderArg(args []interface{}, i int) (binary.ByteOrder, error) {
+	order, err := stringArg(args, i, "be")
+	if err != nil {
+		return nil, err
+	}
+	switch order {
+	case "be":
+		return binary.BigEndian, nil
+	case "le":
+		return binary.LittleEndian, nil
+	}
+	return nil, fmt.Errorf("byte order must be \"be\" or \"le\"")
+}
+
+// offsetArgs returns the offset and byte order arguments of the number
+// transforms
+func offsetArgs(args []interface{}, size int) (int, binary.ByteOrder, error) {
+	max := 2
+	if size == 1 {
+		max = 1
+	}
+	if err := checkArgs(args, 1, max); err != nil {
+		return 0, nil, err
+	}
+	offset, err := intArg(args, 0, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	if offset < 0 {
+		return 0, nil, errors.New("offset must not be negative")
+	}
+	order, err := byteOrderArg(args, 1)
+	return offset, order, err
+}
+
+// readBytes returns the n bytes at the offset
+func readBytes(b []byte, offset int, n int) ([]byte, error) {
+	if n > len(b) || offset > len(b)-n {
+		return nil, fmt.Errorf("reading %d bytes at offset %d of %d bytes", n, offset, len(b))
+	}
+	return b[offset : offset+n], nil
+}
+
+// readUint reads an unsigned integer of size bytes
+func readUint(b []byte, order binary.ByteOrder) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(order.Uint16(b))
+	case 4:
+		return uint64(order.Uint32(b))
+	}
+	return order.Uint64(b)
+}
+
+// intTransform returns a factory reading integers of size bytes. Signed
+// integers are sign extended.
+func intTransform(size int, signed bool) TransformFactory {
+	return func(args ...interface{}) (ValueTransformFunc, error) {
+		offset, order, err := offsetArgs(args, size)
+		if err != nil {
+			return nil, err
+		}
+		return bytesFunc(func(b []byte) (interface{}, error) {
+			field, err := readBytes(b, offset, size)
+			if err != nil {
+				return nil, err
+			}
+			v := readUint(field, order)
+			if signed {
+				shift := 64 - 8*size
+				return int64(v<<shift) >> shift, nil
+			}
+			return v, nil
+		}), nil
+	}
+}
+
+// floatTransform returns a factory reading IEEE 754 floats of size bytes
+func floatTransform(size int) TransformFactory {
+	return func(args ...interface{}) (ValueTransformFunc, error) {
+		offset, order, err := offsetArgs(args, size)
+		if err != nil {
+			return nil, err
+		}
+		return bytesFunc(func(b []byte) (interface{}, error) {
+			field, err := readBytes(b, offset, size)
+			if err != nil {
+				return nil, err
+			}
+			if size == 4 {
+				return math.Float32frombits(order.Uint32(field)), nil
+			}
+			return math.Float64frombits(order.Uint64(field)), nil
+		}), nil
+	}
+}
+
+// bitsTransform extracts a bit field from an integer. The arguments are the
+// position of the lowest bit, counting from the least significant bit, and
+// the number of bits, ie `{{ payload | uint8 0 | bits 4 3 }}`.
+func bitsTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	shift, err := intArg(args, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	count, err := intArg(args, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if shift < 0 || count < 1 || shift+count > 64 {
+		return nil, errors.New("bits must be within 64 bits")
+	}
+	mask := uint64(math.MaxUint64) >> (64 - count)
+	return func(v interface{}) (interface{}, error) {
+		if v == nil {
+			return nil, nil
+		}
+		var n uint64
+		rv := reflect.Indirect(reflect.ValueOf(v))
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = uint64(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n = rv.Uint()
+		case reflect.Invalid:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("bits requires an integer but got %T", v)
+		}
+		return (n >> shift) & mask, nil
+	}, nil
+}
+
+// maxBCDLength is the largest number of bytes decoded by bcd
+const maxBCDLength = 32
+
+// bcdTransform decodes packed binary-coded decimal digits. The arguments are
+// the offset, the number of bytes and the byte order. The digits are returned
+// as a string to keep leading zeros, ie `{{ payload | bcd 0 4 "le" }}`.
+func bcdTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return nil, err
+	}
+	offset, err := intArg(args, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	length, err := intArg(args, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		return nil, errors.New("offset must not be negative")
+	}
+	if length < 1 || length > maxBCDLength {
+		return nil, fmt.Errorf("length must be 1 to %d", maxBCDLength)
+	}
+	order, err := byteOrderArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return bytesFunc(func(b []byte) (interface{}, error) {
+		field, err := readBytes(b, offset, length)
+		if err != nil {
+			return nil, err
+		}
+		digits := make([]byte, 0, 2*length)
+		for i := range field {
+			c := field[i]
+			if order == binary.LittleEndian {
+				c = field[length-1-i]
+			}
+			for _, d := range [2]byte{c >> 4, c & 0x0f} {
+				if d > 9 {
+					return nil, fmt.Errorf("invalid BCD digit 0x%x", d)
+				}
+				digits = append(digits, '0'+d)
+			}
+		}
+		return string(digits), nil
+	}), nil
+}
+
+// getTransform returns the value at the dotted path of decoded maps and
+// slices, ie `{{ payload | cborDecode | get "readings.0.value" }}`. Missing values
+// return nil.
+func getTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	path, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, errors.New("path must not be empty")
+	}
+	keys := strings.Split(path, ".")
+	return func(v interface{}) (interface{}, error) {
+		for _, key := range keys {
+			switch c := v.(type) {
+			case map[string]interface{}:
+				v = c[key]
+			case []interface{}:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(c) {
+					return nil, nil
+				}
+				v = c[i]
+			default:
+				return nil, nil
+			}
+		}
+		return v, nil
+	}, nil
+}
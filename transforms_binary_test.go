@@ -0,0 +1,124 @@
+package goplate
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryTransforms(t *testing.T) {
+	assert := require.New(t)
+
+	payload := []byte{0x12, 0x34, 0xfe, 0xff, 0x41, 0xa8, 0x00, 0x00, 0x19, 0x70, 0x42, 0x01}
+	tests := map[string]string{
+		`{{ substructure.binary | uint8 0 }}`:                  "18",
+		`{{ substructure.binary | uint16 0 }}`:                 "4660",
+		`{{ substructure.binary | uint16 0 "le" }}`:            "13330",
+		`{{ substructure.binary | int16 2 }}`:                  "-257",
+		`{{ substructure.binary | int8 3 }}`:                   "-1",
+		`{{ substructure.binary | uint32 0 }}`:                 "305463039",
+		`{{ substructure.binary | int64 0 }}`:                  "1311953763743301632",
+		`{{ substructure.binary | int32 2 "le" }}`:             "-1472069634",
+		`{{ substructure.binary | float32 4 }}`:                "21",
+		`{{ substructure.binary | uint8 0 | bits 4 4 }}`:       "1",
+		`{{ substructure.binary | uint16 0 | bits 0 12 }}`:     "564",
+		`{{ int32 | bits 1 2 }}`:                               "3",
+		`{{ substructure.binary | bcd 8 4 }}`:                  "19704201",
+		`{{ substructure.binary | bcd 8 4 "le" }}`:             "01427019",
+		`{{ substructure.binary | uint16 0 | padLeft 6 "0" }}`: "004660",
+		`{{ "AQI=" | base64Decode | uint16 0 }}`:               "258",
+		`{{ substructure.subsub | uint8 0 }}`:                  "",
+	}
+	params := &testStructure{Int32: 14, Substructure: &testSubStructure{Binary: payload}}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(params)
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+
+	for _, invalid := range []string{
+		`{{ string | uint16 }}`,
+		`{{ string | uint16 -1 }}`,
+		`{{ string | uint16 0 "middle" }}`,
+		`{{ string | uint8 0 "le" }}`,
+		`{{ string | bits 60 8 }}`,
+		`{{ string | bcd 0 0 }}`,
+		`{{ string | bcd 1 9223372036854775807 }}`,
+		`{{ string | bcd -1 1 }}`,
+		`{{ string | cborDecode 1 }}`,
+		`{{ string | get "" }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+
+	// Short payloads and invalid digits stop the execution
+	for _, tmplStr := range []string{
+		`{{ substructure.binary | uint64 8 }}`,
+		`{{ substructure.binary | bcd 2 1 }}`,
+		`{{ substructure.binary | uint16 9223372036854775807 }}`,
+		`{{ substructure.binary | bcd 9223372036854775807 32 }}`,
+		`{{ substructure.binary | uint8 0 | bits 0 1 | bits 0 1 }} {{ string | bits 0 1 }}`,
+	} {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		_, err = tmpl.ExecuteString(params)
+		assert.Error(err, tmplStr)
+	}
+}
+
+func TestStructuredPayloads(t *testing.T) {
+	assert := require.New(t)
+
+	payloads := map[string]string{
+		// {"t": 21.5, "readings": [{"value": -3}], "ok": true}
+		"cborDecode": "a3" + "6174f94d60" + "68" + hex.EncodeToString([]byte("readings")) +
+			"81a165" + hex.EncodeToString([]byte("value")) + "22" + "626f6bf5",
+		"msgpackDecode": "83" + "a174cb4035800000000000" + "a8" + hex.EncodeToString([]byte("readings")) +
+			"9181a5" + hex.EncodeToString([]byte("value")) + "fd" + "a26f6bc3",
+	}
+	for format, payload := range payloads {
+		tmpl, err := New(`{{ substructure.binary | hexDecode | ` + format + ` | get "t" }} ` +
+			`{{ substructure.binary | hexDecode | ` + format + ` | get "readings.0.value" }} ` +
+			`{{ substructure.binary | hexDecode | ` + format + ` | get "readings.1.value" }}` +
+			`{{ substructure.binary | hexDecode | ` + format + ` | get "ok" }} ` +
+			`{{ substructure.binary | hexDecode | ` + format + ` | get "readings" | json }}`).
+			WithParameters(&testStructure{}).
+			Build()
+		assert.NoError(err)
+		s, err := tmpl.ExecuteString(&testStructure{Substructure: &testSubStructure{Binary: []byte(payload)}})
+		assert.NoError(err, format)
+		assert.Equal(`21.5 -3 true [{"value":-3}]`, s, format)
+	}
+
+	// Indefinite lengths and tags
+	cbor := map[string]interface{}{
+		"9f0102ff":           []interface{}{uint64(1), uint64(2)},
+		"5f42010243030405ff": []byte{1, 2, 3, 4, 5},
+		"bf616101ff":         map[string]interface{}{"a": uint64(1)},
+		"c11a5f5e1000":       uint64(1600000000),
+		"3b7fffffffffffffff": int64(-1 << 63),
+		"f97c00":             math.Inf(1),
+	}
+	for data, expected := range cbor {
+		b, _ := hex.DecodeString(data)
+		v, err := decodeCBOR(b)
+		assert.NoError(err, data)
+		assert.Equal(expected, v, data)
+	}
+
+	for _, invalid := range []string{"", "9f01", "a161", "1c", "0101", "ff", "3bffffffffffffffff"} {
+		b, _ := hex.DecodeString(invalid)
+		_, err := decodeCBOR(b)
+		assert.Error(err, invalid)
+	}
+	for _, invalid := range []string{"", "c1", "92c0", "dc0010", "d9ff", "0101"} {
+		b, _ := hex.DecodeString(invalid)
+		_, err := decodeMsgpack(b)
+		assert.Error(err, invalid)
+	}
+}
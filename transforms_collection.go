@@ -0,0 +1,270 @@
+package goplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// CollectionTransforms returns the transforms for slices and maps. They are
+// registered by default by New.
+//
+// The transforms work on slices, arrays and maps of any type. Maps are used
+// as the list of their values ordered by key. sum and avg require numbers and
+// fixed formats a number with a fixed number of decimals, ie
+// `{{ values | avg | fixed 2 }}`.
+func CollectionTransforms() TransformFactoryMap {
+	return TransformFactoryMap{
+		"len":    noArgsFunc(lenTransform),
+		"first":  noArgsFunc(firstTransform),
+		"last":   noArgsFunc(lastTransform),
+		"sort":   noArgsFunc(sortTransform),
+		"unique": noArgsFunc(uniqueTransform),
+		"sum":    noArgsFunc(sumTransform),
+		"avg":    noArgsFunc(avgTransform),
+		"fixed":  fixedTransform,
+	}
+}
+
+// noArgsFunc returns a factory for a transform without arguments
+func noArgsFunc(f ValueTransformFunc) TransformFactory {
+	return func(args ...interface{}) (ValueTransformFunc, error) {
+		if err := checkArgs(args, 0, 0); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+}
+
+// collectionElements returns the elements of slices, arrays and maps. The
+// values of maps are ordered by key. Strings and byte slices aren't
+// collections.
+func collectionElements(v interface{}) ([]interface{}, bool) {
+	rv := queryValue(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, false
+		}
+		ret := make([]interface{}, rv.Len())
+		for i := range ret {
+			ret[i] = resultValue(rv.Index(i))
+		}
+		return ret, true
+	case reflect.Map:
+		keys := sortedKeys(rv)
+		ret := make([]interface{}, len(keys))
+		for i, key := range keys {
+			ret[i] = resultValue(rv.MapIndex(key))
+		}
+		return ret, true
+	}
+	return nil, false
+}
+
+// numberValue converts numbers to int64 or float64. Unsigned integers larger
+// than the largest int64 are converted to float64.
+func numberValue(v interface{}) (interface{}, bool) {
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return i, true
+		}
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	rv := queryValue(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return float64(rv.Uint()), true
+		}
+		return int64(rv.Uint()), true
+	case reflect.Float32:
+		// Go through the text to avoid float32 rounding errors, ie 0.1
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(rv.Float(), 'g', -1, 32), 64)
+		return f, true
+	case reflect.Float64:
+		return rv.Float(), true
+	}
+	return nil, false
+}
+
+// asFloat64 returns a number from numberValue as a float64
+func asFloat64(n interface{}) float64 {
+	if i, ok := n.(int64); ok {
+		return float64(i)
+	}
+	return n.(float64)
+}
+
+func lenTransform(v interface{}) (interface{}, error) {
+	switch val := plainValue(v).(type) {
+	case string:
+		return utf8.RuneCountInString(val), nil
+	case []byte:
+		return len(val), nil
+	}
+	if elems, ok := collectionElements(v); ok {
+		return len(elems), nil
+	}
+	return nil, nil
+}
+
+func firstTransform(v interface{}) (interface{}, error) {
+	elems, ok := collectionElements(v)
+	if !ok || len(elems) == 0 {
+		return nil, nil
+	}
+	return elems[0], nil
+}
+
+func lastTransform(v interface{}) (interface{}, error) {
+	elems, ok := collectionElements(v)
+	if !ok || len(elems) == 0 {
+		return nil, nil
+	}
+	return elems[len(elems)-1], nil
+}
+
+// sortTransform sorts the elements. Numbers are sorted numerically if all
+// the elements are numbers and other values by their text.
+func sortTransform(v interface{}) (interface{}, error) {
+	elems, ok := collectionElements(v)
+	if !ok {
+		return nil, nil
+	}
+	numbers := make([]float64, len(elems))
+	numeric := true
+	for i, elem := range elems {
+		n, ok := numberValue(elem)
+		if !ok {
+			numeric = false
+			break
+		}
+		numbers[i] = asFloat64(n)
+	}
+	indexes := make([]int, len(elems))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	if numeric {
+		sort.SliceStable(indexes, func(i, j int) bool { return numbers[indexes[i]] < numbers[indexes[j]] })
+	} else {
+		text := make([]string, len(elems))
+		for i, elem := range elems {
+			text[i] = formatValue(elem)
+		}
+		sort.SliceStable(indexes, func(i, j int) bool { return text[indexes[i]] < text[indexes[j]] })
+	}
+	ret := make([]interface{}, len(elems))
+	for i, index := range indexes {
+		ret[i] = elems[index]
+	}
+	return ret, nil
+}
+
+// uniqueTransform removes repeated elements and keeps the first one
+func uniqueTransform(v interface{}) (interface{}, error) {
+	elems, ok := collectionElements(v)
+	if !ok {
+		return nil, nil
+	}
+	seen := make(map[interface{}]bool)
+	ret := make([]interface{}, 0, len(elems))
+	for _, elem := range elems {
+		key := elem
+		if elem != nil && !reflect.TypeOf(elem).Comparable() {
+			key = fmt.Sprintf("%T %v", elem, elem)
+		}
+		if !seen[key] {
+			seen[key] = true
+			ret = append(ret, elem)
+		}
+	}
+	return ret, nil
+}
+
+// sum adds the elements. The sum is an int64 if all the elements are
+// integers and the sum doesn't overflow and a float64 otherwise.
+func sum(v interface{}) (interface{}, int, error) {
+	elems, ok := collectionElements(v)
+	if !ok {
+		return nil, 0, nil
+	}
+	var intSum int64
+	var floatSum float64
+	isInt := true
+	for _, elem := range elems {
+		n, ok := numberValue(elem)
+		if !ok {
+			return nil, 0, fmt.Errorf("expected numbers but got %T", elem)
+		}
+		if i, ok := n.(int64); ok && isInt {
+			// Switch to floats on overflow
+			if s := intSum + i; (i >= 0) == (s >= intSum) {
+				intSum = s
+				continue
+			}
+		}
+		if isInt {
+			floatSum, isInt = float64(intSum), false
+		}
+		floatSum += asFloat64(n)
+	}
+	if isInt {
+		return intSum, len(elems), nil
+	}
+	return floatSum, len(elems), nil
+}
+
+func sumTransform(v interface{}) (interface{}, error) {
+	s, _, err := sum(v)
+	return s, err
+}
+
+// avgTransform returns the average as a float64. Empty collections have no
+// average.
+func avgTransform(v interface{}) (interface{}, error) {
+	s, n, err := sum(v)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return asFloat64(s) / float64(n), nil
+}
+
+// fixedTransform formats numbers with a fixed number of decimals, rounding
+// halves away from zero. Other values are unchanged.
+func fixedTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	decimals, err := intArg(args, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if decimals < 0 || decimals > 20 {
+		return nil, fmt.Errorf("decimals must be 0 to 20")
+	}
+	return func(v interface{}) (interface{}, error) {
+		n, ok := numberValue(v)
+		if !ok {
+			return v, nil
+		}
+		return formatFixed(asFloat64(n), decimals), nil
+	}, nil
+}
+
+// formatFixed formats the number with a fixed number of decimals, rounding
+// halves away from zero
+func formatFixed(f float64, decimals int) string {
+	if scaled := f * math.Pow10(decimals); !math.IsInf(scaled, 0) {
+		f = math.Round(scaled) / math.Pow10(decimals)
+	}
+	return strconv.FormatFloat(f, 'f', decimals, 64)
+}
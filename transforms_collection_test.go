@@ -0,0 +1,103 @@
+package goplate
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectionTransforms(t *testing.T) {
+	assert := require.New(t)
+
+	params := &testStructure{
+		String:        `{"values": [1.5, 2, 3.25], "tags": ["b", "a", "b"], "empty": []}`,
+		ArrayOfint32:  []int32{3, 1, 3, 2},
+		ArrayOfint64:  []int64{-5, 10, math.MaxInt64},
+		ArrayOfuint32: []uint32{},
+		ArrayOfuint64: []uint64{1 << 63, 1 << 63},
+		Substructure: &testSubStructure{
+			Map: map[string]string{"b": "two", "a": "one"},
+		},
+	}
+	tests := map[string]string{
+		`{{ arrayofint32 | len }}`:                             "4",
+		`{{ arrayofuint32 | len }}`:                            "0",
+		`{{ substructure.map | len }}`:                         "2",
+		`{{ "åbc" | len }}`:                                    "3",
+		`{{ arrayofint32 | first }}`:                           "3",
+		`{{ arrayofint32 | last }}`:                            "2",
+		`{{ arrayofuint32 | first }}`:                          "",
+		`{{ substructure.map | first }}`:                       "one",
+		`{{ substructure.map | join "," }}`:                    "one,two",
+		`{{ arrayofint32 | join ";" }}`:                        "3;1;3;2",
+		`{{ arrayofint32 | sort }}`:                            "[1,2,3,3]",
+		`{{ arrayofint32 | sort | unique }}`:                   "[1,2,3]",
+		`{{ arrayofint32 | unique | join "," }}`:               "3,1,2",
+		`{{ arrayofint32 | sort | last }}`:                     "3",
+		`{{ arrayofint32 | sum }}`:                             "9",
+		`{{ arrayofint64 | sum }}`:                             "9223372036854776000",
+		`{{ arrayofuint32 | sum }}`:                            "0",
+		`{{ arrayofuint64 | sum }}`:                            "18446744073709552000",
+		`{{ arrayofint32 | avg }}`:                             "2.25",
+		`{{ arrayofint32 | avg | fixed 1 }}`:                   "2.3",
+		`{{ arrayofuint32 | avg }}`:                            "",
+		`{{ string | jq ".values" | sum }}`:                    "6.75",
+		`{{ string | jq ".values" | avg | fixed 2 }}`:          "2.25",
+		`{{ string | jq ".values" | sort | first | fixed 0 }}`: "2",
+		`{{ string | jq ".tags" | sort | unique | join "," }}`: "a,b",
+		`{{ string | jq ".empty" | first }}`:                   "",
+		`{{ "b,a" | split "," | sort | join "" }}`:             "ab",
+		`{{ int32 | fixed 2 }}`:                                "7.00",
+		`{{ string | len | fixed 1 }}`:                         "64.0",
+		`{{ "x" | fixed 2 }}`:                                  "x",
+		`{{ int32 | first }}`:                                  "",
+	}
+	params.Int32 = 7
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(params)
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+
+	for _, invalid := range []string{
+		`{{ arrayofint32 | len 1 }}`,
+		`{{ arrayofint32 | sort "desc" }}`,
+		`{{ int32 | fixed }}`,
+		`{{ int32 | fixed -1 }}`,
+		`{{ int32 | fixed "2" }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+
+	// Sums of values that aren't numbers stop the execution
+	tmpl, err := New(`{{ string | jq ".tags" | sum }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	_, err = tmpl.ExecuteString(params)
+	assert.Error(err)
+}
+
+func TestStringSliceField(t *testing.T) {
+	assert := require.New(t)
+
+	type params struct {
+		Tags []string
+	}
+	tests := map[string]string{
+		`{{ tags }}`:                            "[b,a,b]",
+		`{{ tags | join "," }}`:                 "b,a,b",
+		`{{ tags | sort | unique | join "," }}`: "a,b",
+		`{{ tags | len }}`:                      "3",
+		`{{ tags | first | upper }}`:            "B",
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&params{}).Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(&params{Tags: []string{"b", "a", "b"}})
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+}
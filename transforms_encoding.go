@@ -0,0 +1,215 @@
+package goplate
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"net/url"
+	"strings"
+)
+
+// EncodingTransforms returns the encoding transforms. They are registered by
+// default by New.
+//
+// The encoders work on the bytes of the value, ie byte slices as is and
+// strings and other values converted to text like the string transforms.
+// nil values, maps and structures render nothing. The decoders return byte
+// slices and fail the execution if the input is invalid.
+func EncodingTransforms() TransformFactoryMap {
+	return TransformFactoryMap{
+		"base64":                encodingTransform(base64Encodings, false),
+		"base64Decode":          encodingTransform(base64Encodings, true),
+		"base32":                encodingTransform(base32Encodings, false),
+		"base32Decode":          encodingTransform(base32Encodings, true),
+		"hex":                   hexTransform,
+		"hexDecode":             hexDecodeTransform,
+		"urlQuery":              stringCodec(url.QueryEscape),
+		"urlQueryDecode":        stringDecoder(url.QueryUnescape),
+		"urlPath":               stringCodec(url.PathEscape),
+		"urlPathDecode":         stringDecoder(url.PathUnescape),
+		"quotedPrintable":       bytesCodec(quotedPrintableEncode),
+		"quotedPrintableDecode": bytesCodec(quotedPrintableDecode),
+	}
+}
+
+// textEncoding is the common interface for the base64 and base32 encodings
+type textEncoding interface {
+	EncodeToString(src []byte) string
+	DecodeString(s string) ([]byte, error)
+}
+
+// base64Encodings are the base64 variants. The raw variants have no padding.
+var base64Encodings = map[string]textEncoding{
+	"std":    base64.StdEncoding,
+	"url":    base64.URLEncoding,
+	"raw":    base64.RawStdEncoding,
+	"rawurl": base64.RawURLEncoding,
+}
+
+// base32Encodings are the base32 variants. The hex variants use the extended
+// hex alphabet and the raw variants have no padding.
+var base32Encodings = map[string]textEncoding{
+	"std":    base32.StdEncoding,
+	"hex":    base32.HexEncoding,
+	"raw":    base32.StdEncoding.WithPadding(base32.NoPadding),
+	"rawhex": base32.HexEncoding.WithPadding(base32.NoPadding),
+}
+
+// bytesFunc returns a transform applying the function to the bytes of the
+// value. Values without a text form return nil.
+func bytesFunc(f func([]byte) (interface{}, error)) ValueTransformFunc {
+	return func(v interface{}) (interface{}, error) {
+		if b, ok := v.([]byte); ok {
+			return f(b)
+		}
+		s, ok := textValue(v)
+		if !ok {
+			return nil, nil
+		}
+		return f([]byte(s))
+	}
+}
+
+// encodingTransform returns a factory for encoding or decoding transforms
+// with the variant as an optional argument. The default variant is "std".
+func encodingTransform(encodings map[string]textEncoding, decode bool) TransformFactory {
+	return func(args ...interface{}) (ValueTransformFunc, error) {
+		if err := checkArgs(args, 0, 1); err != nil {
+			return nil, err
+		}
+		variant, err := stringArg(args, 0, "std")
+		if err != nil {
+			return nil, err
+		}
+		enc, ok := encodings[variant]
+		if !ok {
+			return nil, fmt.Errorf("unknown variant %q", variant)
+		}
+		if decode {
+			return bytesFunc(func(b []byte) (interface{}, error) {
+				return enc.DecodeString(string(b))
+			}), nil
+		}
+		return bytesFunc(func(b []byte) (interface{}, error) {
+			return enc.EncodeToString(b), nil
+		}), nil
+	}
+}
+
+// hexTransform encodes as hex with "lower" (the default) or "upper" case
+// letters and an optional separator between the bytes, ie `hex "upper" ":"`.
+func hexTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 0, 2); err != nil {
+		return nil, err
+	}
+	letters, err := stringArg(args, 0, "lower")
+	if err != nil {
+		return nil, err
+	}
+	sep, err := stringArg(args, 1, "")
+	if err != nil {
+		return nil, err
+	}
+	var digits string
+	switch letters {
+	case "lower":
+		digits = "0123456789abcdef"
+	case "upper":
+		digits = "0123456789ABCDEF"
+	default:
+		return nil, fmt.Errorf("case must be \"lower\" or \"upper\"")
+	}
+	return bytesFunc(func(b []byte) (interface{}, error) {
+		var sb strings.Builder
+		sb.Grow(len(b)*2 + len(b)*len(sep))
+		for i, c := range b {
+			if i > 0 {
+				sb.WriteString(sep)
+			}
+			sb.WriteByte(digits[c>>4])
+			sb.WriteByte(digits[c&0xf])
+		}
+		return sb.String(), nil
+	}), nil
+}
+
+// hexFunc is the hex transform in Builder.Transforms, used when hex has no
+// arguments. It encodes like the hex factory with the default arguments.
+func hexFunc(v interface{}) []byte {
+	if b, ok := v.([]byte); ok {
+		return []byte(hex.EncodeToString(b))
+	}
+	s, ok := textValue(v)
+	if !ok {
+		return nil
+	}
+	return []byte(hex.EncodeToString([]byte(s)))
+}
+
+// hexDecodeTransform decodes hex in either case. The optional separator is
+// removed before decoding.
+func hexDecodeTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return nil, err
+	}
+	sep, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return bytesFunc(func(b []byte) (interface{}, error) {
+		s := string(b)
+		if sep != "" {
+			s = strings.ReplaceAll(s, sep, "")
+		}
+		return hex.DecodeString(s)
+	}), nil
+}
+
+// stringCodec returns a factory for encoders without arguments
+func stringCodec(f func(string) string) TransformFactory {
+	return bytesCodec(func(b []byte) (interface{}, error) {
+		return f(string(b)), nil
+	})
+}
+
+// stringDecoder returns a factory for decoders without arguments
+func stringDecoder(f func(string) (string, error)) TransformFactory {
+	return bytesCodec(func(b []byte) (interface{}, error) {
+		s, err := f(string(b))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(s), nil
+	})
+}
+
+// bytesCodec returns a factory for transforms without arguments working on
+// bytes
+func bytesCodec(f func([]byte) (interface{}, error)) TransformFactory {
+	return func(args ...interface{}) (ValueTransformFunc, error) {
+		if err := checkArgs(args, 0, 0); err != nil {
+			return nil, err
+		}
+		return bytesFunc(f), nil
+	}
+}
+
+func quotedPrintableEncode(b []byte) (interface{}, error) {
+	var buf bytes.Buffer
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func quotedPrintableDecode(b []byte) (interface{}, error) {
+	return io.ReadAll(quotedprintable.NewReader(bytes.NewReader(b)))
+}
@@ -0,0 +1,70 @@
+package goplate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestEncodingTransforms(t *testing.T) {
+	assert := require.New(t)
+
+	params := &testStructure{
+		String: "a b/ü?=",
+		Substructure: &testSubStructure{
+			Binary: []byte{0xfb, 0xff, 0x01},
+			String: wrapperspb.String("-_8B"),
+		},
+	}
+	tests := map[string]string{
+		`{{ substructure.binary | base64 }}`:                   "+/8B",
+		`{{ substructure.binary | base64 "url" }}`:             "-_8B",
+		`{{ substructure.binary | base64 "rawurl" }}`:          "-_8B",
+		`{{ "ab" | base64 "url" }}`:                            "YWI=",
+		`{{ "ab" | base64 "rawurl" }}`:                         "YWI",
+		`{{ "ab" | base64 "raw" | base64Decode "raw" }}`:       "ab",
+		`{{ "ab" | base32 }}`:                                  "MFRA====",
+		`{{ "ab" | base32 "rawhex" }}`:                         "C5H0",
+		`{{ "MFRA====" | base32Decode }}`:                      "ab",
+		`{{ substructure.binary | hex }}`:                      "fbff01",
+		`{{ substructure.binary | hex "upper" ":" }}`:          "FB:FF:01",
+		`{{ "FB:ff:01" | hexDecode ":" | base64 }}`:            "+/8B",
+		`{{ string | urlQuery }}`:                              "a+b%2F%C3%BC%3F%3D",
+		`{{ string | urlPath }}`:                               "a%20b%2F%C3%BC%3F=",
+		`{{ string | urlQuery | urlQueryDecode }}`:             "a b/ü?=",
+		`{{ string | urlPath | urlPathDecode }}`:               "a b/ü?=",
+		`{{ string | quotedPrintable }}`:                       "a b/=C3=BC?=3D",
+		`{{ "a=3Db" | quotedPrintableDecode }}`:                "a=b",
+		`{{ substructure.string | base64Decode "url" | hex }}`: "fbff01",
+		`{{ int32 | hex }}`:                                    "30",
+		`{{ substructure.subsub | base64 }}`:                   "",
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(params)
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+
+	for _, invalid := range []string{
+		`{{ string | base64 "x" }}`,
+		`{{ string | base32 1 }}`,
+		`{{ string | hex "mixed" }}`,
+		`{{ string | urlQuery "x" }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+
+	// Invalid input stops the execution
+	tmpl, err := New(`a{{ string | base64Decode }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	_, err = tmpl.ExecuteString(params)
+	assert.Error(err)
+	tmpl, err = New(`a{{ string | hexDecode | upper }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	_, err = tmpl.ExecuteString(&testStructure{String: "zz"})
+	assert.Error(err)
+}
@@ -0,0 +1,189 @@
+package goplate
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// ErrSecretNotFound is returned by SecretMap when the secret doesn't exist
+var ErrSecretNotFound = errors.New("secret not found")
+
+// errNoSecretProvider is returned by the hmac factory without a secret
+// provider. The template is built with the builder's provider instead.
+var errNoSecretProvider = errors.New("no secret provider is set")
+
+// SecretProvider looks up the secrets used by the hmac transform. Secrets are
+// looked up by name when the template is executed so they never appear in
+// the template and can be rotated without building the template again.
+type SecretProvider interface {
+	Secret(name string) ([]byte, error)
+}
+
+// SecretMap is a SecretProvider with a fixed set of secrets
+type SecretMap map[string][]byte
+
+// Secret returns the named secret
+func (m SecretMap) Secret(name string) ([]byte, error) {
+	secret, ok := m[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return secret, nil
+}
+
+// hashAlgorithms are the hash functions available for digests and HMACs
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// HashTransforms returns the digest transforms. They are registered by
+// default by New. The hmac transform uses the secret provider set with
+// WithSecrets on the builder when the template is built, so the order of
+// WithSecrets and WithTransformFactories doesn't matter.
+//
+// The digests are computed over the bytes of the value like the encoding
+// transforms. The output is "hex" (the default), "base64" or the "raw" bytes
+// for further transforms, ie `{{ body | sha256 "base64" }}`.
+func HashTransforms() TransformFactoryMap {
+	ret := TransformFactoryMap{
+		"crc32": crc32Transform,
+		"hmac":  hmacTransform(nil),
+	}
+	for name, newHash := range hashAlgorithms {
+		ret[name] = hashTransform(newHash)
+	}
+	return ret
+}
+
+// digestOutput returns the function formatting digests for the output
+// argument
+func digestOutput(args []interface{}, i int) (func([]byte) interface{}, error) {
+	output, err := stringArg(args, i, "hex")
+	if err != nil {
+		return nil, err
+	}
+	switch output {
+	case "hex":
+		return func(b []byte) interface{} { return hex.EncodeToString(b) }, nil
+	case "base64":
+		return func(b []byte) interface{} { return base64.StdEncoding.EncodeToString(b) }, nil
+	case "raw":
+		return func(b []byte) interface{} { return b }, nil
+	}
+	return nil, fmt.Errorf("output must be \"hex\", \"base64\" or \"raw\"")
+}
+
+// hashTransform returns a factory for digest transforms with the output as
+// an optional argument
+func hashTransform(newHash func() hash.Hash) TransformFactory {
+	return func(args ...interface{}) (ValueTransformFunc, error) {
+		if err := checkArgs(args, 0, 1); err != nil {
+			return nil, err
+		}
+		output, err := digestOutput(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return bytesFunc(func(b []byte) (interface{}, error) {
+			h := newHash()
+			h.Write(b)
+			return output(h.Sum(nil)), nil
+		}), nil
+	}
+}
+
+// crc32Transform computes the IEEE CRC-32 checksum. The checksum is formatted
+// as 4 big endian bytes.
+func crc32Transform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return nil, err
+	}
+	output, err := digestOutput(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return bytesFunc(func(b []byte) (interface{}, error) {
+		sum := make([]byte, 4)
+		binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(b))
+		return output(sum), nil
+	}), nil
+}
+
+// hmacTransform returns a factory for the hmac transform using the secret
+// provider. The arguments are the name of the secret, the hash algorithm
+// (sha256 by default) and the output, ie `hmac "webhook" "sha1" "base64"`.
+func hmacTransform(secrets SecretProvider) TransformFactory {
+	return func(args ...interface{}) (ValueTransformFunc, error) {
+		if secrets == nil {
+			return nil, errNoSecretProvider
+		}
+		if err := checkArgs(args, 1, 3); err != nil {
+			return nil, err
+		}
+		name, err := stringArg(args, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		algorithm, err := stringArg(args, 1, "sha256")
+		if err != nil {
+			return nil, err
+		}
+		newHash, ok := hashAlgorithms[algorithm]
+		if !ok {
+			return nil, fmt.Errorf("unknown hash algorithm %q", algorithm)
+		}
+		output, err := digestOutput(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return bytesFunc(func(b []byte) (interface{}, error) {
+			secret, err := secrets.Secret(name)
+			if err != nil {
+				return nil, err
+			}
+			mac := hmac.New(newHash, secret)
+			mac.Write(b)
+			return output(mac.Sum(nil)), nil
+		}), nil
+	}
+}
+
+// ExecuteSigned writes the expanded template to the writer like Execute and
+// returns the HMAC of the output, ie for a signature header sent with the
+// body. The secret is looked up by name in the secret provider set with
+// WithSecrets and the hash algorithm defaults to sha256.
+func (t *Template) ExecuteSigned(writer io.Writer, params interface{}, secret string, algorithm string) ([]byte, error) {
+	if t.secrets == nil {
+		return nil, errors.New("no secret provider is set")
+	}
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	newHash, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash algorithm %q", algorithm)
+	}
+	key, err := t.secrets.Secret(secret)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(newHash, key)
+	if err := t.Execute(io.MultiWriter(writer, mac), params); err != nil {
+		return nil, err
+	}
+	return mac.Sum(nil), nil
+}
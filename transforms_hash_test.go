@@ -0,0 +1,109 @@
+package goplate
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashTransforms(t *testing.T) {
+	assert := require.New(t)
+
+	params := &testStructure{String: "abc"}
+	tests := map[string]string{
+		`{{ string | md5 }}`:                            "900150983cd24fb0d6963f7d28e17f72",
+		`{{ string | sha1 }}`:                           "a9993e364706816aba3e25717850c26c9cd0d89d",
+		`{{ string | sha256 }}`:                         "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		`{{ string | sha256 "base64" }}`:                "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=",
+		`{{ string | sha256 "raw" | base64 "rawurl" }}`: "ungWv48Bz-pBQUDeXa4iI7ADYaOWF3qctBD_YfIAFa0",
+		`{{ string | sha512 | substr 0 8 }}`:            "ddaf35a1",
+		`{{ string | crc32 }}`:                          "352441c2",
+		`{{ substructure.subsub | sha256 }}`:            "",
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(params)
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+
+	secrets := SecretMap{"webhook": []byte("key")}
+	params.String = "The quick brown fox jumps over the lazy dog"
+	tmpl, err := New(`{{ string | hmac "webhook" }} {{ string | hmac "webhook" "md5" "base64" }}`).
+		WithParameters(&testStructure{}).
+		WithSecrets(secrets).
+		Build()
+	assert.NoError(err)
+	s, err := tmpl.ExecuteString(params)
+	assert.NoError(err)
+	assert.Equal("f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8 gAcHE0Y+d0m5DC3CSRHidQ==", s)
+
+	// The provider is used when the template is built, so registering the
+	// hash transforms again after WithSecrets keeps it
+	tmpl, err = New(`{{ string | hmac "webhook" }}`).
+		WithParameters(&testStructure{}).
+		WithSecrets(secrets).
+		WithTransformFactories(HashTransforms()).
+		Build()
+	assert.NoError(err)
+	s, err = tmpl.ExecuteString(params)
+	assert.NoError(err)
+	assert.Equal("f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", s)
+
+	// Secrets are looked up when the template is executed
+	tmpl, err = New(`{{ string | hmac "rotated" }}`).WithParameters(&testStructure{}).WithSecrets(secrets).Build()
+	assert.NoError(err)
+	_, err = tmpl.ExecuteString(params)
+	assert.True(errors.Is(err, ErrSecretNotFound))
+	secrets["rotated"] = []byte("key")
+	s, err = tmpl.ExecuteString(params)
+	assert.NoError(err)
+	assert.Equal("f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", s)
+
+	for _, invalid := range []string{
+		`{{ string | sha256 "bin" }}`,
+		`{{ string | hmac }}`,
+		`{{ string | hmac "webhook" "sha3" }}`,
+		`{{ string | hmac "webhook" "sha1" "oct" }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).WithSecrets(secrets).Build()
+		assert.Error(err, invalid)
+	}
+	_, err = New(`{{ string | hmac "webhook" }}`).WithParameters(&testStructure{}).Build()
+	assert.Error(err)
+}
+
+func TestExecuteSigned(t *testing.T) {
+	assert := require.New(t)
+
+	secrets := SecretMap{"webhook": []byte("key")}
+	tmpl, err := New(`The quick brown fox jumps over the {{ string }}`).
+		WithParameters(&testStructure{}).
+		WithSecrets(secrets).
+		Build()
+	assert.NoError(err)
+	buf := &bytes.Buffer{}
+	sig, err := tmpl.ExecuteSigned(buf, &testStructure{String: "lazy dog"}, "webhook", "")
+	assert.NoError(err)
+	assert.Equal("The quick brown fox jumps over the lazy dog", buf.String())
+	assert.Equal("f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", hex.EncodeToString(sig))
+
+	buf.Reset()
+	sig, err = tmpl.ExecuteSigned(buf, &testStructure{String: "lazy dog"}, "webhook", "md5")
+	assert.NoError(err)
+	assert.Equal("80070713463e7749b90c2dc24911e275", hex.EncodeToString(sig))
+
+	_, err = tmpl.ExecuteSigned(buf, &testStructure{}, "missing", "")
+	assert.True(errors.Is(err, ErrSecretNotFound))
+	_, err = tmpl.ExecuteSigned(buf, &testStructure{}, "webhook", "sha3")
+	assert.Error(err)
+
+	tmpl, err = New(`body`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	_, err = tmpl.ExecuteSigned(buf, &testStructure{}, "webhook", "")
+	assert.Error(err)
+}
@@ -0,0 +1,350 @@
+package goplate
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// localeTransformFunc is a transform formatting a value for a locale
+type localeTransformFunc func(locale *Locale, v interface{}) (interface{}, error)
+
+// localeTransformFactory creates a locale transform from the arguments
+type localeTransformFactory func(args ...interface{}) (localeTransformFunc, error)
+
+// localeTransforms returns the transforms using the locale of the execution.
+// Transforms and transform factories with the same names replace them.
+func localeTransforms() map[string]localeTransformFactory {
+	return map[string]localeTransformFactory{
+		"number":   numberTransform,
+		"currency": currencyTransform,
+		"date":     dateTransform,
+		"plural":   pluralTransform,
+		"select":   selectTransform,
+	}
+}
+
+// dateStyles are the date styles in Locale.DateFormats
+var dateStyles = map[string]bool{
+	"short": true, "medium": true, "long": true, "full": true, "time": true, "datetime": true,
+}
+
+// formatNumber formats a number from numberValue. The number is formatted
+// with a fixed number of decimals unless decimals is negative.
+func formatNumber(n interface{}, decimals int) string {
+	if decimals >= 0 {
+		return formatFixed(asFloat64(n), decimals)
+	}
+	if i, ok := n.(int64); ok {
+		return strconv.FormatInt(i, 10)
+	}
+	return strconv.FormatFloat(n.(float64), 'f', -1, 64)
+}
+
+// localizeNumber replaces the decimal point in a formatted number with the
+// locale's separator and groups the digits in the integer part
+func localizeNumber(l *Locale, s string) string {
+	var b strings.Builder
+	if strings.HasPrefix(s, "-") {
+		b.WriteByte('-')
+		s = s[1:]
+	}
+	digits, decimals := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		digits, decimals = s[:i], s[i+1:]
+	}
+	minGrouping := l.MinGrouping
+	if minGrouping < 1 {
+		minGrouping = 1
+	}
+	if len(digits) < 3+minGrouping {
+		b.WriteString(digits)
+	} else {
+		first := len(digits) % 3
+		if first == 0 {
+			first = 3
+		}
+		b.WriteString(digits[:first])
+		for i := first; i < len(digits); i += 3 {
+			b.WriteString(l.Group)
+			b.WriteString(digits[i : i+3])
+		}
+	}
+	if decimals != "" {
+		b.WriteString(l.Decimal)
+		b.WriteString(decimals)
+	}
+	return b.String()
+}
+
+// decimalsArg returns the number of decimals from the arguments or -1 if the
+// argument isn't set
+func decimalsArg(args []interface{}, i int) (int, error) {
+	decimals, err := intArg(args, i, -1)
+	if err != nil {
+		return 0, err
+	}
+	if i < len(args) && (decimals < 0 || decimals > 20) {
+		return 0, fmt.Errorf("decimals must be 0 to 20")
+	}
+	return decimals, nil
+}
+
+// numberTransform formats numbers with the locale's separators. The number
+// of decimals is optional. Other values are unchanged.
+func numberTransform(args ...interface{}) (localeTransformFunc, error) {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return nil, err
+	}
+	decimals, err := decimalsArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return func(l *Locale, v interface{}) (interface{}, error) {
+		n, ok := numberValue(v)
+		if !ok || isNotFinite(n) {
+			return v, nil
+		}
+		return localizeNumber(l, formatNumber(n, decimals)), nil
+	}, nil
+}
+
+// isNotFinite returns true for infinite numbers and NaN
+func isNotFinite(n interface{}) bool {
+	f, ok := n.(float64)
+	return ok && (math.IsInf(f, 0) || math.IsNaN(f))
+}
+
+// currencyTransform formats numbers as an amount in the currency given by the
+// ISO 4217 code, ie `{{ price | currency "EUR" }}`. The number of decimals
+// is optional and defaults to the currency's minor unit.
+func currencyTransform(args ...interface{}) (localeTransformFunc, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+	code, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(code) != 3 || strings.IndexFunc(code, func(r rune) bool { return r < 'A' || r > 'Z' }) >= 0 {
+		return nil, fmt.Errorf("invalid currency code %q", code)
+	}
+	decimals, err := decimalsArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if decimals < 0 {
+		decimals = 2
+		if d, ok := currencyDecimals[code]; ok {
+			decimals = d
+		}
+	}
+	return func(l *Locale, v interface{}) (interface{}, error) {
+		n, ok := numberValue(v)
+		if !ok || isNotFinite(n) {
+			return v, nil
+		}
+		amount := localizeNumber(l, formatFixed(asFloat64(n), decimals))
+		sign := ""
+		if strings.HasPrefix(amount, "-") {
+			sign, amount = "-", amount[1:]
+		}
+		symbol, ok := l.CurrencySymbols[code]
+		if !ok {
+			if symbol, ok = currencySymbols[code]; !ok {
+				symbol = code
+			}
+		}
+		return sign + formatCurrency(l.CurrencyFormat, symbol, amount), nil
+	}, nil
+}
+
+// formatCurrency formats the amount with the currency pattern. Symbols
+// ending in letters are separated from the amount, ie "CHF 12.00".
+func formatCurrency(pattern string, symbol string, amount string) string {
+	if pattern == "" {
+		pattern = "¤#"
+	}
+	last, _ := utf8.DecodeLastRuneInString(symbol)
+	first, _ := utf8.DecodeRuneInString(symbol)
+	if unicode.IsLetter(last) {
+		pattern = strings.Replace(pattern, "¤#", "¤\u00a0#", 1)
+	}
+	if unicode.IsLetter(first) {
+		pattern = strings.Replace(pattern, "#¤", "#\u00a0¤", 1)
+	}
+	return strings.NewReplacer("¤", symbol, "#", amount).Replace(pattern)
+}
+
+// dateTransform formats times with the locale's month and day names. The
+// first argument is a date style (short, medium, long, full, time or
+// datetime) or a Go time layout and defaults to medium. The second argument
+// is the time zone and defaults to UTC. Times are time.Time values,
+// timestamps, nanoseconds since the epoch and RFC 3339 strings. Other values
+// are unchanged.
+func dateTransform(args ...interface{}) (localeTransformFunc, error) {
+	if err := checkArgs(args, 0, 2); err != nil {
+		return nil, err
+	}
+	format, err := stringArg(args, 0, "medium")
+	if err != nil {
+		return nil, err
+	}
+	zone, err := stringArg(args, 1, "UTC")
+	if err != nil {
+		return nil, err
+	}
+	tz, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, err
+	}
+	return func(l *Locale, v interface{}) (interface{}, error) {
+		t, ok := timeValue(v)
+		if !ok {
+			return v, nil
+		}
+		layout := format
+		if dateStyles[format] {
+			if layout, ok = l.DateFormats[format]; !ok {
+				layout = bundledLocales[0].DateFormats[format]
+			}
+		}
+		return formatDate(l, t.In(tz), layout), nil
+	}, nil
+}
+
+// timeValue converts the value to a time
+func timeValue(v interface{}) (time.Time, bool) {
+	switch val := v.(type) {
+	case time.Time:
+		return val, true
+	case *time.Time:
+		if val != nil {
+			return *val, true
+		}
+		return time.Time{}, false
+	case *timestamppb.Timestamp:
+		if val != nil {
+			return val.AsTime(), true
+		}
+		return time.Time{}, false
+	}
+	if n, ok := numberValue(v); ok {
+		ns, ok := n.(int64)
+		return time.Unix(0, ns), ok
+	}
+	if s, ok := textValue(v); ok {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// dateNames are the layout elements replaced by the locale's names. Longer
+// names come first so January isn't matched as Jan.
+var dateNames = []string{"January", "Monday", "Jan", "Mon"}
+
+// formatDate formats the time with the layout, replacing the month and day
+// names with the locale's names
+func formatDate(l *Locale, t time.Time, layout string) string {
+	var b strings.Builder
+	start := 0
+	for i := 0; i < len(layout); i++ {
+		for _, name := range dateNames {
+			if !strings.HasPrefix(layout[i:], name) {
+				continue
+			}
+			if i > start {
+				b.WriteString(t.Format(layout[start:i]))
+			}
+			switch name {
+			case "January":
+				b.WriteString(l.Months[t.Month()-1])
+			case "Jan":
+				b.WriteString(l.ShortMonths[t.Month()-1])
+			case "Monday":
+				b.WriteString(l.Days[t.Weekday()])
+			case "Mon":
+				b.WriteString(l.ShortDays[t.Weekday()])
+			}
+			i += len(name) - 1
+			start = i + 1
+			break
+		}
+	}
+	if start < len(layout) {
+		b.WriteString(t.Format(layout[start:]))
+	}
+	return b.String()
+}
+
+// pluralTransform picks the text for the plural category of the number in
+// the locale's language. The arguments are the texts for one and other, ie
+// `plural "# device" "# devices"`, or the cases in the ICU syntax, ie
+// `plural "=0 {no devices} one {# device} other {# devices}"`. # is the
+// number. Other values are unchanged.
+func pluralTransform(args ...interface{}) (localeTransformFunc, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+	var cases map[string]*message
+	if len(args) == 2 {
+		cases = make(map[string]*message)
+		for i, category := range []string{"one", "other"} {
+			text, err := stringArg(args, i, "")
+			if err != nil {
+				return nil, err
+			}
+			if cases[category], err = parsePluralCase(text); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		text, err := stringArg(args, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		if cases, err = parseCases(text, true); err != nil {
+			return nil, err
+		}
+	}
+	return func(l *Locale, v interface{}) (interface{}, error) {
+		n, ok := numberValue(v)
+		if !ok {
+			return v, nil
+		}
+		var b strings.Builder
+		ctx := &messageContext{locale: l, tag: l.Tag, args: []interface{}{v}}
+		selectCase(cases, pluralKeys(l.Tag, n)).format(&b, ctx, n)
+		return b.String(), nil
+	}, nil
+}
+
+// selectTransform picks the text for the value from cases in the ICU
+// syntax, ie `select "sensor {Sensor} gateway {Gateway} other {Device}"`.
+// The other case is used for values without a case.
+func selectTransform(args ...interface{}) (localeTransformFunc, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	text, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	cases, err := parseCases(text, false)
+	if err != nil {
+		return nil, err
+	}
+	return func(l *Locale, v interface{}) (interface{}, error) {
+		var b strings.Builder
+		ctx := &messageContext{locale: l, tag: l.Tag, args: []interface{}{v}}
+		selectCase(cases, []string{formatValue(v)}).format(&b, ctx, nil)
+		return b.String(), nil
+	}, nil
+}
@@ -0,0 +1,156 @@
+package goplate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestLocaleTransforms(t *testing.T) {
+	assert := require.New(t)
+
+	ts := time.Date(2024, time.March, 5, 14, 7, 0, 0, time.UTC)
+	params := &testStructure{
+		Int32:        -1234567,
+		Int64:        ts.UnixNano(),
+		Int64Wrapper: wrapperspb.Int64(ts.UnixNano()),
+		String:       `{"price": 1234.5, "small": 0.125, "at": "2024-12-24T23:30:00Z"}`,
+	}
+	tests := map[string]map[string]string{
+		"": {
+			`{{ int32 | number }}`:                                "-1,234,567",
+			`{{ string | jq ".price" | number }}`:                 "1,234.5",
+			`{{ string | jq ".price" | number 2 }}`:               "1,234.50",
+			`{{ string | jq ".small" | number 2 }}`:               "0.13",
+			`{{ string | jq ".price" | currency "USD" }}`:         "$1,234.50",
+			`{{ int32 | currency "USD" }}`:                        "-$1,234,567.00",
+			`{{ string | jq ".price" | currency "JPY" }}`:         "¥1,235",
+			`{{ string | jq ".price" | currency "CHF" }}`:         "CHF\u00a01,234.50",
+			`{{ string | jq ".price" | currency "EUR" 0 }}`:       "€1,235",
+			`{{ int64 | date }}`:                                  "Mar 5, 2024",
+			`{{ int64wrapper | date "full" }}`:                    "Tuesday, March 5, 2024",
+			`{{ int64 | date "datetime" }}`:                       "Mar 5, 2024, 2:07 PM",
+			`{{ int64 | date "Mon 2 Jan 15:04" }}`:                "Tue 5 Mar 14:07",
+			`{{ string | jq ".at" | date "short" }}`:              "12/24/24",
+			`{{ string | jq ".at" | date "long" "Europe/Oslo" }}`: "December 25, 2024",
+			`{{ "x" | number }}`:                                  "x",
+			`{{ "x" | date }}`:                                    "x",
+		},
+		"de-DE": {
+			`{{ int32 | number }}`:                        "-1.234.567",
+			`{{ string | jq ".price" | number }}`:         "1.234,5",
+			`{{ string | jq ".price" | currency "EUR" }}`: "1.234,50\u00a0€",
+			`{{ int32 | currency "EUR" }}`:                "-1.234.567,00\u00a0€",
+			`{{ int64 | date "full" }}`:                   "Dienstag, 5. März 2024",
+			`{{ int64 | date "short" }}`:                  "05.03.24",
+			`{{ int64 | date "Jan" }}`:                    "März",
+		},
+		"fr": {
+			`{{ int32 | number }}`:                        "-1\u202f234\u202f567",
+			`{{ string | jq ".price" | currency "EUR" }}`: "1\u202f234,50\u00a0€",
+			`{{ int64 | date "long" }}`:                   "5 mars 2024",
+		},
+		"es-ES": {
+			`{{ string | jq ".price" | number }}`: "1234,5",
+			`{{ int32 | number }}`:                "-1.234.567",
+			`{{ int64 | date "full" }}`:           "martes, 5 de marzo de 2024",
+		},
+		"nb_no": {
+			`{{ string | jq ".price" | currency "NOK" }}`: "1\u00a0234,50\u00a0kr",
+			`{{ int64 | date "medium" }}`:                 "5. mar. 2024",
+		},
+		"pt-BR": {
+			`{{ string | jq ".price" | currency "BRL" }}`: "R$\u00a01.234,50",
+		},
+		"ja-JP": {
+			`{{ string | jq ".price" | currency "JPY" }}`: "￥1,235",
+			`{{ int64 | date "full" }}`:                   "2024年3月5日火曜日",
+		},
+	}
+	for locale, cases := range tests {
+		for tmplStr, expected := range cases {
+			tmpl, err := New(tmplStr).WithParameters(&testStructure{}).WithLocale(locale).Build()
+			assert.NoError(err, tmplStr)
+			s, err := tmpl.ExecuteString(params)
+			assert.NoError(err, tmplStr)
+			assert.Equal(expected, s, locale+" "+tmplStr)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{{ int32 | number "2" }}`,
+		`{{ int32 | number 21 }}`,
+		`{{ int32 | currency }}`,
+		`{{ int32 | currency "eur" }}`,
+		`{{ int32 | currency "EURO" }}`,
+		`{{ int64 | date "short" "Nowhere/City" }}`,
+		`{{ int64 | date "short" "UTC" 1 }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+
+	// Transforms with the same name replace the locale transforms
+	tmpl, err := New(`{{ int32 | number }}`).
+		WithParameters(&testStructure{}).
+		WithTransformFactories(TransformFactoryMap{"number": noArgsFunc(func(v interface{}) (interface{}, error) {
+			return "custom", nil
+		})}).
+		Build()
+	assert.NoError(err)
+	s, err := tmpl.ExecuteString(params)
+	assert.NoError(err)
+	assert.Equal("custom", s)
+}
+
+func TestExecuteLocale(t *testing.T) {
+	assert := require.New(t)
+
+	_, err := New(`{{ int32 | number }}`).WithParameters(&testStructure{}).WithLocale("xx-YY").Build()
+	assert.True(errors.Is(err, ErrUnknownLocale))
+
+	// The locale for the execution is used by the partials too
+	tmpl, err := New(`{{ int32 | number }} {{ include "amount" }}`).
+		WithParameters(&testStructure{}).
+		WithLocale("de-DE").
+		WithPartial("amount", `{{ int32 | currency "EUR" 0 }}`).
+		Build()
+	assert.NoError(err)
+	params := &testStructure{Int32: 12345}
+
+	s, err := tmpl.ExecuteString(params)
+	assert.NoError(err)
+	assert.Equal("12.345 12.345\u00a0€", s)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(tmpl.ExecuteContext(context.Background(), buf, params, ExecuteOptions{Locale: "en-GB"}))
+	assert.Equal("12,345 €12,345", buf.String())
+
+	err = tmpl.ExecuteContext(context.Background(), &bytes.Buffer{}, params, ExecuteOptions{Locale: "xx"})
+	assert.True(errors.Is(err, ErrUnknownLocale))
+
+	// Registered locales are available to all templates
+	custom := *mustLocale(t, "en-US")
+	custom.Tag = "en-CH"
+	custom.Group = "'"
+	custom.CurrencyFormat = "¤ #"
+	RegisterLocale(&custom)
+	buf.Reset()
+	assert.NoError(tmpl.ExecuteContext(context.Background(), buf, params, ExecuteOptions{Locale: "en-ch"}))
+	assert.Equal("12'345 € 12'345", buf.String())
+
+	l, err := LookupLocale("de-AT")
+	assert.NoError(err)
+	assert.Equal("de-DE", l.Tag)
+}
+
+func mustLocale(t *testing.T, tag string) *Locale {
+	l, err := LookupLocale(tag)
+	require.NoError(t, err)
+	return l
+}
@@ -0,0 +1,331 @@
+package goplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// QueryTransforms returns the jq transform. It is registered by default by
+// New.
+//
+// The jq transform takes a query with a subset of the jq path syntax: keys
+// (`.name`, `."a key"` or `.["a key"]`), indexes (`[0]` or `[-1]` from the
+// end), slices (`[1:3]`) and iteration over all elements (`[]`), ie
+// `{{ body | jq ".readings[0].value" }}`. Strings and byte slices are decoded
+// as JSON first. Structures are queried directly with field names matched like
+// in templates or by their json name. The query is parsed when the template is
+// built.
+//
+// A query returns nil when a key or index doesn't exist. Queries that iterate
+// return a slice of the results.
+func QueryTransforms() TransformFactoryMap {
+	return TransformFactoryMap{
+		"jq": jqTransform,
+	}
+}
+
+// Step types in queries
+const (
+	queryKey = iota
+	queryIndex
+	querySlice
+	queryIterate
+)
+
+// queryStep is a step in a query. Slices without a start or end use the
+// start or end of the value.
+type queryStep struct {
+	typ      int
+	key      string
+	index    int
+	end      int
+	hasStart bool
+	hasEnd   bool
+}
+
+// parseQuery parses a jq path
+func parseQuery(query string) ([]queryStep, error) {
+	var steps []queryStep
+	pos := 0
+	next := func() byte {
+		if pos < len(query) {
+			return query[pos]
+		}
+		return 0
+	}
+	if next() != '.' {
+		return nil, fmt.Errorf("query must start with \".\"")
+	}
+	for pos < len(query) {
+		switch next() {
+		case '.':
+			pos++
+			switch c := next(); {
+			case c == '"':
+				key, err := parseQueryString(query, &pos)
+				if err != nil {
+					return nil, err
+				}
+				steps = append(steps, queryStep{typ: queryKey, key: key})
+			case isQueryIdent(c, true):
+				start := pos
+				for pos < len(query) && isQueryIdent(query[pos], false) {
+					pos++
+				}
+				steps = append(steps, queryStep{typ: queryKey, key: query[start:pos]})
+			case c == '[' || (c == 0 && pos == 1):
+			default:
+				return nil, fmt.Errorf("expected key at %d", pos)
+			}
+		case '[':
+			pos++
+			step, err := parseQueryBracket(query, &pos)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", query[pos], pos)
+		}
+	}
+	return steps, nil
+}
+
+func isQueryIdent(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+// parseQueryString parses a quoted string at the position
+func parseQueryString(query string, pos *int) (string, error) {
+	start := *pos
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case '"':
+			*pos = i + 1
+			s, err := strconv.Unquote(query[start : i+1])
+			if err != nil {
+				return "", fmt.Errorf("invalid string at %d", start)
+			}
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unterminated string at %d", start)
+}
+
+// parseQueryBracket parses the contents of brackets after the opening bracket
+func parseQueryBracket(query string, pos *int) (queryStep, error) {
+	var step queryStep
+	skipSpace := func() {
+		for *pos < len(query) && query[*pos] == ' ' {
+			*pos++
+		}
+	}
+	number := func() (int, bool, error) {
+		skipSpace()
+		start := *pos
+		if *pos < len(query) && query[*pos] == '-' {
+			*pos++
+		}
+		for *pos < len(query) && query[*pos] >= '0' && query[*pos] <= '9' {
+			*pos++
+		}
+		if *pos == start {
+			return 0, false, nil
+		}
+		n, err := strconv.Atoi(query[start:*pos])
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid index at %d", start)
+		}
+		skipSpace()
+		return n, true, nil
+	}
+
+	skipSpace()
+	switch {
+	case *pos < len(query) && query[*pos] == ']':
+		step.typ = queryIterate
+	case *pos < len(query) && query[*pos] == '"':
+		key, err := parseQueryString(query, pos)
+		if err != nil {
+			return step, err
+		}
+		step = queryStep{typ: queryKey, key: key}
+		skipSpace()
+	default:
+		var err error
+		step.typ = queryIndex
+		if step.index, step.hasStart, err = number(); err != nil {
+			return step, err
+		}
+		if *pos < len(query) && query[*pos] == ':' {
+			*pos++
+			step.typ = querySlice
+			if step.end, step.hasEnd, err = number(); err != nil {
+				return step, err
+			}
+		} else if !step.hasStart {
+			return step, fmt.Errorf("expected index at %d", *pos)
+		}
+	}
+	if *pos >= len(query) || query[*pos] != ']' {
+		return step, fmt.Errorf("expected \"]\" at %d", *pos)
+	}
+	*pos++
+	return step, nil
+}
+
+func jqTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	query, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	steps, err := parseQuery(strings.TrimSpace(query))
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %q: %v", query, err)
+	}
+	iterates := false
+	for _, step := range steps {
+		iterates = iterates || step.typ == queryIterate
+	}
+	return func(v interface{}) (interface{}, error) {
+		var buf []byte
+		switch val := v.(type) {
+		case string:
+			buf = []byte(val)
+		case []byte:
+			buf = val
+		}
+		if buf != nil {
+			dec := json.NewDecoder(bytes.NewReader(buf))
+			dec.UseNumber()
+			v = nil
+			if err := dec.Decode(&v); err != nil {
+				return nil, fmt.Errorf("jq: %v", err)
+			}
+		}
+		results := []interface{}{v}
+		for _, step := range steps {
+			var next []interface{}
+			for _, r := range results {
+				next = step.apply(r, next)
+			}
+			results = next
+		}
+		if iterates {
+			return results, nil
+		}
+		if len(results) == 0 {
+			return nil, nil
+		}
+		return results[0], nil
+	}, nil
+}
+
+// queryValue returns the value to query with wrappers and pointers resolved
+func queryValue(v interface{}) reflect.Value {
+	return indirectValue(reflect.ValueOf(plainValue(v)))
+}
+
+// resultValue returns the value as a result
+func resultValue(rv reflect.Value) interface{} {
+	if !rv.IsValid() || !rv.CanInterface() {
+		return nil
+	}
+	return rv.Interface()
+}
+
+// apply appends the results of the step on the value. Steps that don't apply
+// to the type of the value have no results.
+func (s queryStep) apply(v interface{}, results []interface{}) []interface{} {
+	rv := queryValue(v)
+	switch s.typ {
+	case queryKey:
+		switch rv.Kind() {
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return results
+			}
+			return append(results, resultValue(rv.MapIndex(reflect.ValueOf(s.key).Convert(rv.Type().Key()))))
+		case reflect.Struct:
+			t := rv.Type()
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				if f.PkgPath != "" {
+					continue
+				}
+				name := strings.Split(f.Tag.Get("json"), ",")[0]
+				if strings.EqualFold(f.Name, s.key) || (name != "" && name == s.key) {
+					return append(results, resultValue(rv.Field(i)))
+				}
+			}
+			return append(results, nil)
+		}
+
+	case queryIndex:
+		if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			i := s.index
+			if i < 0 {
+				i += rv.Len()
+			}
+			if i < 0 || i >= rv.Len() {
+				return append(results, nil)
+			}
+			return append(results, resultValue(rv.Index(i)))
+		}
+
+	case querySlice:
+		if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array || rv.Kind() == reflect.String {
+			start, end := 0, rv.Len()
+			if s.hasStart {
+				start = s.index
+			}
+			if s.hasEnd {
+				end = s.end
+			}
+			if start < 0 {
+				start += rv.Len()
+			}
+			if end < 0 {
+				end += rv.Len()
+			}
+			start, end = clamp(start, 0, rv.Len()), clamp(end, 0, rv.Len())
+			if end < start {
+				end = start
+			}
+			if rv.Kind() == reflect.Array {
+				ret := make([]interface{}, end-start)
+				for i := range ret {
+					ret[i] = resultValue(rv.Index(start + i))
+				}
+				return append(results, ret)
+			}
+			return append(results, resultValue(rv.Slice(start, end)))
+		}
+
+	case queryIterate:
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				results = append(results, resultValue(rv.Index(i)))
+			}
+		case reflect.Map:
+			for _, key := range sortedKeys(rv) {
+				results = append(results, resultValue(rv.MapIndex(key)))
+			}
+		case reflect.Struct:
+			for _, f := range structFields(rv) {
+				results = append(results, resultValue(f.value))
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,71 @@
+package goplate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestJQTransform(t *testing.T) {
+	assert := require.New(t)
+
+	params := &testStructure{
+		String:       `{"readings": [{"value": 21.5, "unit": "C"}, {"value": 7}], "a key": {"b": true}}`,
+		ArrayOfint32: []int32{1, 2, 3, 4},
+		Substructure: &testSubStructure{
+			String: wrapperspb.String("sub"),
+			Map:    map[string]string{"name": "x"},
+			SubSub: &testSubSubStructure{Int: 3},
+		},
+	}
+	tests := map[string]string{
+		`{{ string | jq ".readings[0].value" }}`:                        "21.5",
+		`{{ string | jq ".readings[-1].value" }}`:                       "7",
+		`{{ string | jq ".readings[].value" }}`:                         "[21.5,7]",
+		`{{ string | jq ".readings[].unit" }}`:                          "[C,]",
+		`{{ string | jq ".readings[5].value" }}`:                        "",
+		`{{ string | jq ".\"a key\".b" }}`:                              "true",
+		`{{ string | jq ".[\"a key\"][\"b\"]" }}`:                       "true",
+		`{{ string | jq ".readings[1]" | json }}`:                       `{"value":7}`,
+		`{{ string | jq ".missing.deeper" }}`:                           "",
+		`{{ string | jq "." | jq ".readings[0].unit" }}`:                "C",
+		`{{ arrayofint32 | jq ".[1:3]" }}`:                              "[2,3]",
+		`{{ arrayofint32 | jq ".[-2:]" }}`:                              "[3,4]",
+		`{{ arrayofint32 | jq ".[:1][0]" }}`:                            "1",
+		`{{ substructure | jq ".map.name" }}`:                           "x",
+		`{{ substructure | jq ".String" | upper }}`:                     "SUB",
+		`{{ substructure | jq ".subsub.int" }}`:                         "3",
+		`{{ substructure | jq ".map[]" }}`:                              "[x]",
+		`{{ substructure | jq ".nofield" }}`:                            "",
+		`{{ substructure | msgpack | msgpackDecode | jq ".Map.name" }}`: "x",
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(params)
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+
+	// Queries are parsed when the template is built
+	for _, invalid := range []string{
+		`{{ string | jq }}`,
+		`{{ string | jq "readings" }}`,
+		`{{ string | jq ".readings[" }}`,
+		`{{ string | jq ".readings[x]" }}`,
+		`{{ string | jq ".readings[0" }}`,
+		`{{ string | jq ".\"key" }}`,
+		`{{ string | jq "..a" }}`,
+		`{{ string | jq ".a b" }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+
+	// Invalid JSON stops the execution
+	tmpl, err := New(`{{ string | jq ".a" }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	_, err = tmpl.ExecuteString(&testStructure{String: "{"})
+	assert.Error(err)
+}
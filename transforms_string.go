@@ -0,0 +1,372 @@
+package goplate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// StringTransforms returns the string manipulation transforms. They are
+// registered by default by New.
+//
+// The transforms render nothing for nil values, maps and structures. Other
+// values that aren't strings are converted to text first the way they are
+// rendered, ie numbers and bools are formatted and byte slices, like the
+// output from the json transform, are used as text. Lengths and offsets are
+// counted in characters, not bytes.
+func StringTransforms() TransformFactoryMap {
+	return TransformFactoryMap{
+		"upper":        noArgs(strings.ToUpper),
+		"lower":        noArgs(strings.ToLower),
+		"title":        noArgs(title),
+		"trim":         trimTransform,
+		"trimPrefix":   trimPrefixTransform,
+		"trimSuffix":   trimSuffixTransform,
+		"replace":      replaceTransform,
+		"regexReplace": regexReplaceTransform,
+		"substr":       substrTransform,
+		"truncate":     truncateTransform,
+		"padLeft":      padTransform(true),
+		"padRight":     padTransform(false),
+		"repeat":       repeatTransform,
+		"split":        splitTransform,
+		"join":         joinTransform,
+	}
+}
+
+// checkArgs checks the number of arguments
+func checkArgs(args []interface{}, min int, max int) error {
+	switch {
+	case len(args) >= min && len(args) <= max:
+		return nil
+	case min == max:
+		return fmt.Errorf("expected %d arguments but got %d", min, len(args))
+	}
+	return fmt.Errorf("expected %d to %d arguments but got %d", min, max, len(args))
+}
+
+// stringArg returns the argument as a string or the default value if the
+// argument isn't set
+func stringArg(args []interface{}, i int, def string) (string, error) {
+	if i >= len(args) {
+		return def, nil
+	}
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %d must be a string", i+1)
+	}
+	return s, nil
+}
+
+// intArg returns the argument as an int or the default value if the argument
+// isn't set
+func intArg(args []interface{}, i int, def int) (int, error) {
+	if i >= len(args) {
+		return def, nil
+	}
+	n, ok := args[i].(int64)
+	if !ok {
+		return 0, fmt.Errorf("argument %d must be an integer", i+1)
+	}
+	return int(n), nil
+}
+
+// stringFunc returns a transform applying the function to values converted
+// to strings. Values without a text form return nil.
+func stringFunc(f func(string) string) ValueTransformFunc {
+	return func(v interface{}) (interface{}, error) {
+		s, ok := textValue(v)
+		if !ok {
+			return nil, nil
+		}
+		return f(s), nil
+	}
+}
+
+// noArgs returns a factory for string functions without arguments
+func noArgs(f func(string) string) TransformFactory {
+	return func(args ...interface{}) (ValueTransformFunc, error) {
+		if err := checkArgs(args, 0, 0); err != nil {
+			return nil, err
+		}
+		return stringFunc(f), nil
+	}
+}
+
+// title makes the first letter in each word upper case
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		first := unicode.IsSpace(prev)
+		prev = r
+		if first {
+			return unicode.ToTitle(r)
+		}
+		return r
+	}, s)
+}
+
+// trim removes leading and trailing white space or the characters in the
+// optional cut set
+func trimTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return stringFunc(strings.TrimSpace), nil
+	}
+	cutset, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return stringFunc(func(s string) string { return strings.Trim(s, cutset) }), nil
+}
+
+func trimPrefixTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	prefix, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return stringFunc(func(s string) string { return strings.TrimPrefix(s, prefix) }), nil
+}
+
+func trimSuffixTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	suffix, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return stringFunc(func(s string) string { return strings.TrimSuffix(s, suffix) }), nil
+}
+
+// replace replaces all occurrences of a string
+func replaceTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	old, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := stringArg(args, 1, "")
+	if err != nil {
+		return nil, err
+	}
+	return stringFunc(func(s string) string { return strings.ReplaceAll(s, old, replacement) }), nil
+}
+
+// regexReplace replaces the matches of a regular expression. The replacement
+// can refer to groups with $1 or ${name}.
+func regexReplaceTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	pattern, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := stringArg(args, 1, "")
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return stringFunc(func(s string) string { return re.ReplaceAllString(s, replacement) }), nil
+}
+
+// substr returns the characters from the start to the end or the optional
+// length. A negative start is counted from the end.
+func substrTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+	start, err := intArg(args, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	length, err := intArg(args, 1, -1)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 1 && length < 0 {
+		return nil, fmt.Errorf("length can't be negative")
+	}
+	return stringFunc(func(s string) string {
+		runes := []rune(s)
+		from := start
+		if from < 0 {
+			from += len(runes)
+		}
+		from = clamp(from, 0, len(runes))
+		to := len(runes)
+		if length >= 0 {
+			to = clamp(from+length, from, len(runes))
+		}
+		return string(runes[from:to])
+	}), nil
+}
+
+func clamp(v, min, max int) int {
+	switch {
+	case v < min:
+		return min
+	case v > max:
+		return max
+	}
+	return v
+}
+
+// truncate cuts strings longer than the length and adds an ellipsis. The
+// result, including the ellipsis, is at most the length. The default
+// ellipsis is "...".
+func truncateTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+	length, err := intArg(args, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	ellipsis, err := stringArg(args, 1, "...")
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("length can't be negative")
+	}
+	ellipsisLen := len([]rune(ellipsis))
+	return stringFunc(func(s string) string {
+		runes := []rune(s)
+		if len(runes) <= length {
+			return s
+		}
+		if ellipsisLen >= length {
+			return string(runes[:length])
+		}
+		return string(runes[:length-ellipsisLen]) + ellipsis
+	}), nil
+}
+
+// maxTextLength is the longest text created by padding and repeat, in
+// characters for padding and bytes for repeat
+const maxTextLength = 1 << 20
+
+// padTransform returns a factory for transforms padding strings to a length.
+// The padding is repeated as needed and defaults to a space.
+func padTransform(left bool) TransformFactory {
+	return func(args ...interface{}) (ValueTransformFunc, error) {
+		if err := checkArgs(args, 1, 2); err != nil {
+			return nil, err
+		}
+		length, err := intArg(args, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if length > maxTextLength {
+			return nil, fmt.Errorf("length can't be more than %d", maxTextLength)
+		}
+		pad, err := stringArg(args, 1, " ")
+		if err != nil {
+			return nil, err
+		}
+		if pad == "" {
+			return nil, fmt.Errorf("padding can't be empty")
+		}
+		padding := []rune(pad)
+		return stringFunc(func(s string) string {
+			n := length - len([]rune(s))
+			if n <= 0 {
+				return s
+			}
+			fill := make([]rune, n)
+			for i := range fill {
+				fill[i] = padding[i%len(padding)]
+			}
+			if left {
+				return string(fill) + s
+			}
+			return s + string(fill)
+		}), nil
+	}
+}
+
+// repeat repeats a string. Results longer than maxTextLength are an error
+// when the template is executed.
+func repeatTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	count, err := intArg(args, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 || count > maxTextLength {
+		return nil, fmt.Errorf("count must be 0 to %d", maxTextLength)
+	}
+	return func(v interface{}) (interface{}, error) {
+		s, ok := textValue(v)
+		if !ok {
+			return nil, nil
+		}
+		if count > 0 && len(s) > maxTextLength/count {
+			return nil, fmt.Errorf("repeating %d bytes %d times is more than %d bytes", len(s), count, maxTextLength)
+		}
+		return strings.Repeat(s, count), nil
+	}, nil
+}
+
+// split splits a string into a slice of strings. The slice is rendered as a
+// list unless it's joined.
+func splitTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	sep, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return func(v interface{}) (interface{}, error) {
+		s, ok := textValue(v)
+		if !ok {
+			return nil, nil
+		}
+		return strings.Split(s, sep), nil
+	}, nil
+}
+
+// join joins the elements of a slice, or the values of a map ordered by key,
+// with a separator. Other values are converted to strings.
+func joinTransform(args ...interface{}) (ValueTransformFunc, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	sep, err := stringArg(args, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return func(v interface{}) (interface{}, error) {
+		switch val := v.(type) {
+		case []string:
+			return strings.Join(val, sep), nil
+		case []byte, string:
+			return val, nil
+		}
+		elems, ok := collectionElements(v)
+		if !ok {
+			return stringFunc(func(s string) string { return s })(v)
+		}
+		text := make([]string, len(elems))
+		for i, elem := range elems {
+			text[i] = formatValue(elem)
+		}
+		return strings.Join(text, sep), nil
+	}, nil
+}
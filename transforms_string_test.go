@@ -0,0 +1,151 @@
+package goplate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestStringTransforms(t *testing.T) {
+	assert := require.New(t)
+
+	params := &testStructure{
+		String: "  Hello, wörld  ",
+		Int32:  42,
+		Substructure: &testSubStructure{
+			String: wrapperspb.String("a-b-c"),
+			Bool:   true,
+		},
+		ArrayOfint64: []int64{3, 1, 2},
+	}
+	tests := map[string]string{
+		`{{ string | upper }}`:                                   "  HELLO, WÖRLD  ",
+		`{{ string | lower | trim }}`:                            "hello, wörld",
+		`{{ "hello big world" | title }}`:                        "Hello Big World",
+		`{{ substructure.string | trim "ac" }}`:                  "-b-",
+		`{{ substructure.string | trimPrefix "a-" }}`:            "b-c",
+		`{{ substructure.string | trimSuffix "-c" }}`:            "a-b",
+		`{{ substructure.string | replace "-" "+" }}`:            "a+b+c",
+		`{{ string | regexReplace "(\\pL+), (\\pL+)" "$2 $1" }}`: "  wörld Hello  ",
+		`{{ string | trim | substr 7 }}`:                         "wörld",
+		`{{ string | trim | substr -5 3 }}`:                      "wör",
+		`{{ string | trim | substr 20 }}`:                        "",
+		`{{ string | trim | truncate 8 }}`:                       "Hello...",
+		`{{ string | trim | truncate 8 "…" }}`:                   "Hello, …",
+		`{{ string | trim | truncate 20 }}`:                      "Hello, wörld",
+		`{{ int32 | padLeft 5 "0" }}`:                            "00042",
+		`{{ int32 | padRight 6 "ab" }}`:                          "42abab",
+		`{{ substructure.bool | repeat 2 }}`:                     "truetrue",
+		`{{ substructure.string | split "-" }}`:                  "[a,b,c]",
+		`{{ substructure.string | split "-" | join "/" }}`:       "a/b/c",
+		`{{ arrayofint64 | join ", " }}`:                         "3, 1, 2",
+		`{{ substructure.map | upper }}`:                         "",
+		`{{ substructure.subsub | upper }}`:                      "",
+		`{{ int32 * 2 | padLeft 4 }}`:                            "  84",
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).WithParameters(&testStructure{}).Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(params)
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+
+	for _, invalid := range []string{
+		`{{ string | upper 1 }}`,
+		`{{ string | truncate }}`,
+		`{{ string | truncate "1" }}`,
+		`{{ string | truncate -1 }}`,
+		`{{ string | substr 1 -1 }}`,
+		`{{ string | padLeft 3 "" }}`,
+		`{{ string | padLeft 9223372036854775807 }}`,
+		`{{ string | padRight 1048577 }}`,
+		`{{ string | repeat 9223372036854775807 }}`,
+		`{{ string | repeat -1 }}`,
+		`{{ string | regexReplace "(" "" }}`,
+		`{{ string | replace "a" }}`,
+		`{{ string | json 1 }}`,
+		`{{ string | truncate int32 }}`,
+	} {
+		_, err := New(invalid).WithParameters(&testStructure{}).Build()
+		assert.Error(err, invalid)
+	}
+}
+
+func TestFloatFieldText(t *testing.T) {
+	assert := require.New(t)
+
+	params := &testStructure{Substructure: &testSubStructure{SubSub: &testSubSubStructure{Float32: 0.1, Float64: 1.5}}}
+	tmpl, err := New(`{{ substructure.subsub.float64 }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	rendered, err := tmpl.ExecuteString(params)
+	assert.NoError(err)
+	sum := sha256.Sum256([]byte(rendered))
+
+	// Text transforms see the float as it is rendered, numeric transforms
+	// and user transforms get the number
+	tests := map[string]string{
+		`{{ substructure.subsub.float64 | sha256 }}`:         hex.EncodeToString(sum[:]),
+		`{{ substructure.subsub.float64 | padLeft 14 }}`:     "  " + rendered,
+		`{{ substructure.subsub.float64 | fixed 2 }}`:        "1.50",
+		`{{ substructure.subsub.float32 | number }}`:         "0.1",
+		`{{ substructure.subsub.float64 | json }}`:           "1.5",
+		`{{ substructure.subsub.float64 | half }}`:           "0.75",
+		`{{ substructure.subsub.float32 | kind }}`:           "float32",
+		`{{ substructure.subsub.float64 | kind }}`:           "float64",
+		`{{ substructure.subsub.float64 * 1 | padLeft 13 }}`: " 1.5000000000",
+	}
+	for tmplStr, expected := range tests {
+		tmpl, err := New(tmplStr).
+			WithParameters(&testStructure{}).
+			WithTransforms(TransformFunctionMap{"half": func(v interface{}) []byte {
+				return []byte(strconv.FormatFloat(v.(float64)/2, 'f', -1, 64))
+			}}).
+			WithTransformFactories(TransformFactoryMap{"kind": func(args ...interface{}) (ValueTransformFunc, error) {
+				return func(v interface{}) (interface{}, error) { return fmt.Sprintf("%T", v), nil }, nil
+			}}).
+			Build()
+		assert.NoError(err, tmplStr)
+		s, err := tmpl.ExecuteString(params)
+		assert.NoError(err, tmplStr)
+		assert.Equal(expected, s, tmplStr)
+	}
+}
+
+func TestRepeatLimit(t *testing.T) {
+	assert := require.New(t)
+
+	tmpl, err := New(`{{ string | repeat 1048576 | repeat 2 }}`).WithParameters(&testStructure{}).Build()
+	assert.NoError(err)
+	_, err = tmpl.ExecuteString(&testStructure{String: "a"})
+	assert.Error(err)
+}
+
+func TestTransformFactories(t *testing.T) {
+	assert := require.New(t)
+
+	prefix := func(args ...interface{}) (ValueTransformFunc, error) {
+		p, err := stringArg(args, 0, ">")
+		if err != nil {
+			return nil, err
+		}
+		return func(v interface{}) (interface{}, error) {
+			return p + formatValue(v), nil
+		}, nil
+	}
+	tmpl, err := New(`{{ int32 | prefix }} {{ int32 | prefix "#" | upper }}`).
+		WithParameters(&testStructure{}).
+		WithTransformFactories(TransformFactoryMap{"prefix": prefix}).
+		// Transform functions take precedence over factories
+		WithTransforms(TransformFunctionMap{"upper": func(v interface{}) []byte { return []byte("UP") }}).
+		Build()
+	assert.NoError(err)
+	s, err := tmpl.ExecuteString(&testStructure{Int32: 1})
+	assert.NoError(err)
+	assert.Equal(">1 UP", s)
+}